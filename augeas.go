@@ -0,0 +1,166 @@
+package aferoguestfs
+
+import (
+	"fmt"
+)
+
+// AugeasFlags are flags for OpenAugeas.
+type AugeasFlags int
+
+// Augeas flags, see aug_init(3).
+const (
+	// AugeasSaveBackup keeps the original file with a .augsave extension.
+	AugeasSaveBackup AugeasFlags = 1
+	// AugeasSaveNewFile saves changes into a file with a .augnew extension.
+	AugeasSaveNewFile AugeasFlags = 2
+	// AugeasTypeCheck typechecks lenses.
+	AugeasTypeCheck AugeasFlags = 4
+	// AugeasNoStdinc doesn't use the standard load path for modules.
+	AugeasNoStdinc AugeasFlags = 8
+	// AugeasSaveNoop makes Save a dry run.
+	AugeasSaveNoop AugeasFlags = 16
+	// AugeasNoLoad doesn't load the tree on open.
+	AugeasNoLoad AugeasFlags = 32
+)
+
+// Augeas edits configuration files of the guest as a tree using Augeas.
+// Paths in the tree are Augeas path expressions; files appear under "/files",
+// e.g. "/files/etc/hosts/1/canonical".
+//
+// Only one Augeas handle can be open per guestfs handle at a time.
+type Augeas struct {
+	fs *Fs
+}
+
+// OpenAugeas loads the configuration files of the filesystem into an Augeas
+// tree.
+func (fs *Fs) OpenAugeas(flags AugeasFlags) (*Augeas, error) {
+	if err := fs.guestfs.Aug_init("/", int(flags)); err != nil {
+		return nil, fmt.Errorf("aug_init failed: %w", err)
+	}
+	return &Augeas{fs: fs}, nil
+}
+
+// Close closes the handle, discarding unsaved changes.
+func (a *Augeas) Close() error {
+	if err := a.fs.guestfs.Aug_close(); err != nil {
+		return fmt.Errorf("aug_close failed: %w", err)
+	}
+	return nil
+}
+
+// Load reloads the tree from the files, discarding unsaved changes.
+func (a *Augeas) Load() error {
+	if err := a.fs.guestfs.Aug_load(); err != nil {
+		return fmt.Errorf("aug_load failed: %w", err)
+	}
+	return nil
+}
+
+// Save writes the changes back to the files.
+func (a *Augeas) Save() error {
+	a.fs.invalidateAll()
+	if err := a.fs.guestfs.Aug_save(); err != nil {
+		return fmt.Errorf("aug_save failed: %w", err)
+	}
+	return nil
+}
+
+// Get returns the value of the node matched by path. It fails if path
+// matches zero or more than one node.
+func (a *Augeas) Get(path string) (string, error) {
+	val, err := a.fs.guestfs.Aug_get(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	return val, nil
+}
+
+// Set sets the value of the node matched by path, creating it if it doesn't
+// exist.
+func (a *Augeas) Set(path string, val string) error {
+	if err := a.fs.guestfs.Aug_set(path, val); err != nil {
+		return fmt.Errorf("failed to set %s: %w", path, err)
+	}
+	return nil
+}
+
+// Match returns the paths of all nodes matching expr.
+func (a *Augeas) Match(expr string) ([]string, error) {
+	paths, err := a.fs.guestfs.Aug_match(expr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to match %s: %w", expr, err)
+	}
+	return paths, nil
+}
+
+// Each calls fn with the path of every node matching expr, stopping at the
+// first error.
+func (a *Augeas) Each(expr string, fn func(path string) error) error {
+	paths, err := a.Match(expr)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove removes all nodes matching expr and their children, returning the
+// number of removed nodes.
+func (a *Augeas) Remove(expr string) (int, error) {
+	n, err := a.fs.guestfs.Aug_rm(expr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove %s: %w", expr, err)
+	}
+	return n, nil
+}
+
+// Insert creates a sibling node called label before or after the node
+// matched by path.
+func (a *Augeas) Insert(path string, label string, before bool) error {
+	if err := a.fs.guestfs.Aug_insert(path, label, before); err != nil {
+		return fmt.Errorf("failed to insert %s next to %s: %w", label, path, err)
+	}
+	return nil
+}
+
+// Move moves the node matched by src to dest.
+func (a *Augeas) Move(src string, dest string) error {
+	if err := a.fs.guestfs.Aug_mv(src, dest); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", src, dest, err)
+	}
+	return nil
+}
+
+// Label returns the label of the node matched by path.
+func (a *Augeas) Label(path string) (string, error) {
+	label, err := a.fs.guestfs.Aug_label(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get label of %s: %w", path, err)
+	}
+	return label, nil
+}
+
+// Transaction calls fn and saves its changes if it succeeds. If fn or the
+// save fails, the changes are discarded by reloading the tree.
+func (a *Augeas) Transaction(fn func(a *Augeas) error) error {
+	err := fn(a)
+	if err == nil {
+		err = a.Save()
+	}
+
+	if err != nil {
+		if loadErr := a.Load(); loadErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, loadErr)
+		}
+		return err
+	}
+
+	return nil
+}
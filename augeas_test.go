@@ -0,0 +1,96 @@
+package aferoguestfs_test
+
+import (
+	"errors"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testHosts = "127.0.0.1 localhost\n192.168.0.1 server\n"
+
+func TestAugeasSet(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.Mkdir("etc", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "etc/hosts", []byte(testHosts), 0644))
+
+	aug, err := gfs.OpenAugeas(0)
+	require.Nil(t, err)
+	defer aug.Close()
+
+	paths, err := aug.Match("/files/etc/hosts/*/canonical")
+	require.Nil(t, err)
+	assert.Equal(t, []string{
+		"/files/etc/hosts/1/canonical",
+		"/files/etc/hosts/2/canonical",
+	}, paths)
+
+	val, err := aug.Get("/files/etc/hosts/2/canonical")
+	require.Nil(t, err)
+	assert.Equal(t, "server", val)
+
+	require.Nil(t, aug.Set("/files/etc/hosts/2/canonical", "db"))
+	require.Nil(t, aug.Save())
+
+	body, err := afero.ReadFile(gfs, "etc/hosts")
+	require.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\n192.168.0.1 db\n", string(body))
+}
+
+func TestAugeasEach(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.Mkdir("etc", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "etc/hosts", []byte(testHosts), 0644))
+
+	aug, err := gfs.OpenAugeas(0)
+	require.Nil(t, err)
+	defer aug.Close()
+
+	ips := []string{}
+	err = aug.Each("/files/etc/hosts/*/ipaddr", func(path string) error {
+		ip, err := aug.Get(path)
+		ips = append(ips, ip)
+		return err
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"127.0.0.1", "192.168.0.1"}, ips)
+}
+
+func TestAugeasTransactionRollback(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.Mkdir("etc", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "etc/hosts", []byte(testHosts), 0644))
+
+	aug, err := gfs.OpenAugeas(0)
+	require.Nil(t, err)
+	defer aug.Close()
+
+	expected := errors.New("expected")
+	err = aug.Transaction(func(a *aferoguestfs.Augeas) error {
+		if _, err := a.Remove("/files/etc/hosts/2"); err != nil {
+			return err
+		}
+		return expected
+	})
+	assert.ErrorIs(t, err, expected)
+
+	paths, err := aug.Match("/files/etc/hosts/*")
+	require.Nil(t, err)
+	assert.Len(t, paths, 2)
+
+	err = aug.Transaction(func(a *aferoguestfs.Augeas) error {
+		_, err := a.Remove("/files/etc/hosts/2")
+		return err
+	})
+	assert.Nil(t, err)
+
+	body, err := afero.ReadFile(gfs, "etc/hosts")
+	require.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\n", string(body))
+}
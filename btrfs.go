@@ -0,0 +1,60 @@
+package aferoguestfs
+
+import (
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// Subvolume describes a btrfs subvolume.
+type Subvolume struct {
+	ID         uint64
+	TopLevelID uint64
+
+	// Path is relative to the top-level subvolume.
+	Path string
+}
+
+// Subvolumes lists all subvolumes of the btrfs filesystem mounted at the root.
+func (fs *Fs) Subvolumes() ([]Subvolume, error) {
+	subvols, err := fs.guestfs.Btrfs_subvolume_list("/")
+	if err != nil {
+		return nil, wrapErr(err, "/")
+	}
+
+	ret := make([]Subvolume, 0, len(*subvols))
+	for _, s := range *subvols {
+		ret = append(ret, Subvolume{
+			ID:         s.Btrfssubvolume_id,
+			TopLevelID: s.Btrfssubvolume_top_level_id,
+			Path:       s.Btrfssubvolume_path,
+		})
+	}
+
+	return ret, nil
+}
+
+// CreateSubvolume creates a new btrfs subvolume at name.
+func (fs *Fs) CreateSubvolume(name string) error {
+	name = fs.resolvePath(name)
+	fs.invalidate(name)
+	return wrapErr(fs.guestfs.Btrfs_subvolume_create(name, nil), name)
+}
+
+// DeleteSubvolume deletes the btrfs subvolume or snapshot at name.
+func (fs *Fs) DeleteSubvolume(name string) error {
+	name = fs.resolvePath(name)
+	fs.invalidate(name)
+	return wrapErr(fs.guestfs.Btrfs_subvolume_delete(name), name)
+}
+
+// Snapshot creates a snapshot of the subvolume source at dest. If readonly is
+// set, the snapshot can't be modified.
+func (fs *Fs) Snapshot(source string, dest string, readonly bool) error {
+	source = fs.resolvePath(source)
+	dest = fs.resolvePath(dest)
+	fs.invalidate(dest)
+
+	return wrapErr(fs.guestfs.Btrfs_subvolume_snapshot(source, dest, &guestfs.OptargsBtrfs_subvolume_snapshot{
+		Ro_is_set: true,
+		Ro:        readonly,
+	}), dest)
+}
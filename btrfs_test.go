@@ -0,0 +1,91 @@
+package aferoguestfs_test
+
+import (
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBtrfsImage(t *testing.T) string {
+	return newImage(t, 256*1024*1024, func(g *guestfs.Guestfs) error {
+		if err := g.Part_disk("/dev/sda", "mbr"); err != nil {
+			return err
+		}
+		if err := g.Mkfs_btrfs([]string{"/dev/sda1"}, nil); err != nil {
+			return err
+		}
+		if err := g.Mount("/dev/sda1", "/"); err != nil {
+			return err
+		}
+		if err := g.Btrfs_subvolume_create("/root", nil); err != nil {
+			return err
+		}
+		if err := g.Write("/root/test.txt", []byte("in subvolume")); err != nil {
+			return err
+		}
+		return g.Umount_all()
+	})
+}
+
+func TestOpenBtrfsSubvolumeFs(t *testing.T) {
+	image := newBtrfsImage(t)
+
+	fsys, err := aferoguestfs.OpenBtrfsSubvolumeFs(image, "/dev/sda1", "root")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	body, err := afero.ReadFile(fsys, "test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "in subvolume", string(body))
+}
+
+func TestOpenPartitionFsBtrfsvol(t *testing.T) {
+	image := newBtrfsImage(t)
+
+	fsys, err := aferoguestfs.OpenPartitionFs(image, "btrfsvol:/dev/sda1/root")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	body, err := afero.ReadFile(fsys, "test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "in subvolume", string(body))
+	assert.Equal(t, "/dev/sda", fsys.Disk.Device())
+}
+
+func TestSnapshot(t *testing.T) {
+	image := newBtrfsImage(t)
+
+	fsys, err := aferoguestfs.OpenPartitionFs(image, "/dev/sda1")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	err = fsys.Snapshot("root", "snap", true)
+	assert.Nil(t, err)
+
+	body, err := afero.ReadFile(fsys, "snap/test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "in subvolume", string(body))
+
+	err = afero.WriteFile(fsys, "snap/test.txt", []byte("changed"), 0644)
+	assert.NotNil(t, err)
+
+	subvols, err := fsys.Subvolumes()
+	require.Nil(t, err)
+
+	paths := []string{}
+	for _, s := range subvols {
+		paths = append(paths, s.Path)
+	}
+	assert.ElementsMatch(t, []string{"root", "snap"}, paths)
+
+	err = fsys.DeleteSubvolume("snap")
+	assert.Nil(t, err)
+
+	exists, err := afero.Exists(fsys, "snap")
+	require.Nil(t, err)
+	assert.False(t, exists)
+}
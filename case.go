@@ -0,0 +1,98 @@
+package aferoguestfs
+
+import (
+	"path"
+	"sync"
+)
+
+// caseCache maps paths to their case-sensitive form when case-insensitive
+// lookup is enabled.
+type caseCache struct {
+	mu      sync.Mutex
+	enabled bool
+	paths   map[string]string
+}
+
+// SetCaseInsensitive enables or disables case-insensitive paths. When
+// enabled, every path is resolved with Case_sensitive_path to the case of the
+// existing file, as Windows would, before it is used. This is meant for NTFS
+// and FAT filesystems. Resolved paths are cached until the filesystem is
+// changed through Fs.
+func (fs *Fs) SetCaseInsensitive(enabled bool) {
+	fs.paths.mu.Lock()
+	defer fs.paths.mu.Unlock()
+
+	fs.paths.enabled = enabled
+	fs.paths.paths = nil
+}
+
+// CaseInsensitive reports whether case-insensitive paths are enabled.
+func (fs *Fs) CaseInsensitive() bool {
+	fs.paths.mu.Lock()
+	defer fs.paths.mu.Unlock()
+
+	return fs.paths.enabled
+}
+
+// resolvePath normalizes name and, with case-insensitive paths enabled,
+// corrects its case. Paths that can't be resolved, e.g. because a parent
+// directory doesn't exist, are returned normalized so the caller fails with
+// the usual error.
+func (fs *Fs) resolvePath(name string) string {
+	name = normalizePath(name)
+
+	fs.paths.mu.Lock()
+	defer fs.paths.mu.Unlock()
+
+	if !fs.paths.enabled {
+		return name
+	}
+
+	if p, ok := fs.paths.paths[name]; ok {
+		return p
+	}
+
+	p, err := fs.guestfs.Case_sensitive_path(name)
+	if err != nil {
+		return name
+	}
+
+	if fs.paths.paths == nil {
+		fs.paths.paths = map[string]string{}
+	}
+	fs.paths.paths[name] = p
+
+	return p
+}
+
+// resolveParent is like resolvePath but only corrects the case of the parent
+// directory of name, keeping the case of its last component.
+func (fs *Fs) resolveParent(name string) string {
+	name = normalizePath(name)
+	if name == "/" {
+		return name
+	}
+	return path.Join(fs.resolvePath(path.Dir(name)), path.Base(name))
+}
+
+// invalidate drops cached state about the guest filesystem after names were
+// created, removed or written.
+func (fs *Fs) invalidate(names ...string) {
+	fs.paths.mu.Lock()
+	fs.paths.paths = nil
+	fs.paths.mu.Unlock()
+
+	for _, name := range names {
+		fs.ids.invalidate(name)
+	}
+}
+
+// invalidateAll drops all cached state about the guest filesystem after an
+// operation that may have changed any file, e.g. running a guest command.
+func (fs *Fs) invalidateAll() {
+	fs.paths.mu.Lock()
+	fs.paths.paths = nil
+	fs.paths.mu.Unlock()
+
+	fs.ids.reset()
+}
@@ -0,0 +1,60 @@
+package aferoguestfs_test
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaseInsensitive(t *testing.T) {
+	clear(t, gfs)
+	defer gfs.SetCaseInsensitive(false)
+
+	require.Nil(t, gfs.MkdirAll("/Windows/System32", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "/Windows/System32/Config.txt", []byte("some text"), 0644))
+
+	_, err := gfs.Stat("/windows/system32/config.TXT")
+	assert.NotNil(t, err)
+
+	gfs.SetCaseInsensitive(true)
+	assert.True(t, gfs.CaseInsensitive())
+
+	info, err := gfs.Stat("/windows/system32/config.TXT")
+	require.Nil(t, err)
+	assert.Equal(t, "Config.txt", info.Name())
+
+	// new files are created in the existing directory
+	require.Nil(t, afero.WriteFile(gfs, "/WINDOWS/new.txt", []byte("new text"), 0644))
+
+	gfs.SetCaseInsensitive(false)
+	bs, err := afero.ReadFile(gfs, "/Windows/new.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "new text", string(bs))
+
+	// cached paths are dropped when files are created
+	gfs.SetCaseInsensitive(true)
+	_, err = gfs.Stat("/windows/other.txt")
+	assert.NotNil(t, err)
+	require.Nil(t, afero.WriteFile(gfs, "/Windows/Other.txt", []byte("other text"), 0644))
+	bs, err = afero.ReadFile(gfs, "/windows/other.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "other text", string(bs))
+}
+
+func TestCaseInsensitiveRenameCase(t *testing.T) {
+	clear(t, gfs)
+	defer gfs.SetCaseInsensitive(false)
+
+	require.Nil(t, afero.WriteFile(gfs, "/foo", []byte("some text"), 0644))
+
+	gfs.SetCaseInsensitive(true)
+	require.Nil(t, gfs.Rename("/foo", "/FOO"))
+
+	gfs.SetCaseInsensitive(false)
+	infos, err := afero.ReadDir(gfs, "/")
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "FOO", infos[0].Name())
+}
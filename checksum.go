@@ -0,0 +1,157 @@
+package aferoguestfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// ChecksumAlgo is a checksum algorithm supported by Fs.Checksum.
+type ChecksumAlgo string
+
+// Checksum algorithms.
+const (
+	CRC    ChecksumAlgo = "crc"
+	MD5    ChecksumAlgo = "md5"
+	SHA1   ChecksumAlgo = "sha1"
+	SHA224 ChecksumAlgo = "sha224"
+	SHA256 ChecksumAlgo = "sha256"
+	SHA384 ChecksumAlgo = "sha384"
+	SHA512 ChecksumAlgo = "sha512"
+)
+
+// ManifestEntry is a line of a checksum manifest.
+type ManifestEntry struct {
+	// Path is the absolute path of the file.
+	Path   string
+	Digest string
+}
+
+// Checksum returns the checksum of the regular file name as a hex string, or
+// a decimal number for CRC.
+func (fs *Fs) Checksum(algo ChecksumAlgo, name string) (string, error) {
+	name = fs.resolvePath(name)
+	digest, err := fs.guestfs.Checksum(string(algo), name)
+	return digest, wrapErr(err, name)
+}
+
+// Manifest computes the checksums of all regular files below dir and calls fn
+// for each of them. The appliance writes the manifest to a named pipe rather
+// than a file on disk, and it is parsed into memory as it arrives.
+//
+// fn is only called once the appliance is done, so fn may use fs. All entries
+// are therefore held in memory at once, and an error returned by fn stops the
+// iteration but not the checksumming.
+func (fs *Fs) Manifest(dir string, algo ChecksumAlgo, fn func(ManifestEntry) error) error {
+	dir = fs.resolvePath(dir)
+
+	tmpDir, err := os.MkdirTemp("", "afero-guestfs-manifest-*")
+	if err != nil {
+		return fmt.Errorf("failed to create tmp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	fifo := filepath.Join(tmpDir, "sums")
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		return fmt.Errorf("failed to create fifo: %w", err)
+	}
+
+	// Opening the read end without blocking and holding a write end open
+	// ourselves keeps the reader from seeing EOF before Checksums_out opens
+	// the pipe, and from blocking forever if Checksums_out fails before it
+	// does.
+	r, err := os.OpenFile(fifo, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open fifo: %w", err)
+	}
+	defer r.Close()
+
+	w, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open fifo: %w", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		err := fs.guestfs.Checksums_out(string(algo), dir, fifo)
+		w.Close()
+		errc <- err
+	}()
+
+	entries, err := readManifest(r, dir, algo)
+
+	// unblock the writer if reading stopped early
+	io.Copy(io.Discard, r)
+
+	if outErr := <-errc; outErr != nil {
+		return wrapErr(outErr, dir)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readManifest parses the output of checksums-out.
+func readManifest(r io.Reader, dir string, algo ChecksumAlgo) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry, err := parseManifestLine(scanner.Text(), dir, algo)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	return entries, nil
+}
+
+// parseManifestLine parses a line of md5sum-style ("digest  ./path") or
+// cksum-style ("crc size ./path") output.
+func parseManifestLine(line string, dir string, algo ChecksumAlgo) (ManifestEntry, error) {
+	// coreutils escapes file names containing newlines or backslashes and
+	// marks the line with a leading backslash
+	escaped := strings.HasPrefix(line, "\\")
+	line = strings.TrimPrefix(line, "\\")
+
+	var digest, name string
+	var ok bool
+	if algo == CRC {
+		var rest string
+		digest, rest, ok = strings.Cut(line, " ")
+		if ok {
+			_, name, ok = strings.Cut(rest, " ")
+		}
+	} else {
+		digest, name, ok = strings.Cut(line, "  ")
+	}
+	if !ok {
+		return ManifestEntry{}, fmt.Errorf("malformed manifest line: %q", line)
+	}
+
+	if escaped {
+		name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+	}
+
+	return ManifestEntry{
+		Path:   filepath.Join(dir, name),
+		Digest: digest,
+	}, nil
+}
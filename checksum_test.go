@@ -0,0 +1,108 @@
+package aferoguestfs_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum(t *testing.T) {
+	clear(t, gfs)
+
+	err := afero.WriteFile(gfs, "test.txt", []byte("some text"), os.ModePerm)
+	require.Nil(t, err)
+
+	digest, err := gfs.Checksum(aferoguestfs.SHA256, "test.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "b94f6f125c79e3a5ffaa826f584c10d52ada669e6762051b826b55776d05aed2", digest)
+
+	digest, err = gfs.Checksum(aferoguestfs.MD5, "test.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "552e21cd4cd9918678e3c1a0df491bc3", digest)
+}
+
+func TestChecksumNotExist(t *testing.T) {
+	clear(t, gfs)
+
+	_, err := gfs.Checksum(aferoguestfs.SHA256, "test.txt")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestManifest(t *testing.T) {
+	clear(t, gfs)
+
+	err := afero.WriteFile(gfs, "test1.txt", []byte("some text"), os.ModePerm)
+	require.Nil(t, err)
+
+	err = gfs.Mkdir("testdir", os.ModePerm)
+	require.Nil(t, err)
+
+	err = afero.WriteFile(gfs, "testdir/test2.txt", []byte("some text"), os.ModePerm)
+	require.Nil(t, err)
+
+	var entries []aferoguestfs.ManifestEntry
+	err = gfs.Manifest("/", aferoguestfs.MD5, func(e aferoguestfs.ManifestEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	assert.ElementsMatch(t, []aferoguestfs.ManifestEntry{
+		{Path: "/test1.txt", Digest: "552e21cd4cd9918678e3c1a0df491bc3"},
+		{Path: "/testdir/test2.txt", Digest: "552e21cd4cd9918678e3c1a0df491bc3"},
+	}, entries)
+}
+
+func TestManifestStop(t *testing.T) {
+	clear(t, gfs)
+
+	err := afero.WriteFile(gfs, "test1.txt", []byte("some text"), os.ModePerm)
+	require.Nil(t, err)
+
+	err = afero.WriteFile(gfs, "test2.txt", []byte("some text"), os.ModePerm)
+	require.Nil(t, err)
+
+	expected := errors.New("expected")
+	calls := 0
+	err = gfs.Manifest("/", aferoguestfs.SHA1, func(e aferoguestfs.ManifestEntry) error {
+		calls++
+		return expected
+	})
+	assert.ErrorIs(t, err, expected)
+	assert.Equal(t, 1, calls)
+}
+
+func TestManifestUseFs(t *testing.T) {
+	clear(t, gfs)
+
+	err := afero.WriteFile(gfs, "test1.txt", []byte("some text"), os.ModePerm)
+	require.Nil(t, err)
+
+	// fn runs after the appliance is done, so it can use the handle
+	err = gfs.Manifest("/", aferoguestfs.SHA256, func(e aferoguestfs.ManifestEntry) error {
+		digest, err := gfs.Checksum(aferoguestfs.SHA256, e.Path)
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, digest, e.Digest)
+		return gfs.Remove(e.Path)
+	})
+	assert.Nil(t, err)
+
+	_, err = gfs.Stat("test1.txt")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestManifestNotExist(t *testing.T) {
+	clear(t, gfs)
+
+	err := gfs.Manifest("/missing", aferoguestfs.SHA1, func(e aferoguestfs.ManifestEntry) error {
+		return nil
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,507 @@
+// Command guestfs-afero edits disk images from scripts using the
+// afero-guestfs Fs.
+//
+// Usage:
+//
+//	guestfs-afero -a disk.img [-ro] [-p /dev/sda1 | -i] command [args...]
+//
+// Structured output such as ls, stat, checksum and diff is printed as JSON.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+)
+
+type command struct {
+	usage string
+	run   func(o *opener, fs *aferoguestfs.Fs, args []string) error
+}
+
+var commands = map[string]command{
+	"ls":       {"ls path", runLs},
+	"cat":      {"cat path", runCat},
+	"put":      {"put [-m mode] local|- path", runPut},
+	"get":      {"get path local|-", runGet},
+	"rm":       {"rm [-r] path", runRm},
+	"mkdir":    {"mkdir [-p] [-m mode] path", runMkdir},
+	"chmod":    {"chmod mode path", runChmod},
+	"chown":    {"chown [-h] uid:gid path", runChown},
+	"stat":     {"stat path", runStat},
+	"tar-out":  {"tar-out dir [tarfile|-]", runTarOut},
+	"tar-in":   {"tar-in tarfile|- dir", runTarIn},
+	"checksum": {"checksum [-a algo] path", runChecksum},
+	"diff":     {"diff [-dir dir] [-content] [-xattrs] [-ignore-mtime] other-image", runDiff},
+}
+
+// opener opens images the way the global flags ask for.
+type opener struct {
+	partition string
+	inspect   bool
+	readOnly  bool
+}
+
+func (o *opener) open(image string) (*aferoguestfs.PartitionFs, error) {
+	if o.inspect {
+		fs, _, err := aferoguestfs.OpenInspectedFs(image, o.readOnly)
+		return fs, err
+	}
+	if o.readOnly {
+		return aferoguestfs.OpenMountTableFs(image, []aferoguestfs.Mount{
+			{Device: o.partition, Mountpoint: "/", ReadOnly: true},
+		})
+	}
+	return aferoguestfs.OpenPartitionFs(image, o.partition)
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "guestfs-afero: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("guestfs-afero", flag.ContinueOnError)
+	flags.Usage = func() { usage(flags) }
+
+	image := flags.String("a", "", "disk image")
+	o := &opener{}
+	flags.StringVar(&o.partition, "p", "/dev/sda1", "partition to mount at the root")
+	flags.BoolVar(&o.inspect, "i", false, "inspect the image and mount its filesystems like the guest does")
+	flags.BoolVar(&o.readOnly, "ro", false, "open the image read-only")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *image == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("missing image or command")
+	}
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		flags.Usage()
+		return fmt.Errorf("unknown command %s", flags.Arg(0))
+	}
+
+	fs, err := o.open(*image)
+	if err != nil {
+		return err
+	}
+
+	err = cmd.run(o, fs.Fs, flags.Args()[1:])
+	if closeErr := fs.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func usage(flags *flag.FlagSet) {
+	fmt.Fprintf(flags.Output(), "Usage: guestfs-afero -a image [-ro] [-p partition | -i] command [args...]\n\nFlags:\n")
+	flags.PrintDefaults()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(flags.Output(), "\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(flags.Output(), "  %s\n", commands[name].usage)
+	}
+}
+
+// parseArgs parses the flags of a command and checks its number of
+// positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string, minArgs int, maxArgs int) ([]string, error) {
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() < minArgs || flags.NArg() > maxArgs {
+		return nil, fmt.Errorf("%s: wrong number of arguments", flags.Name())
+	}
+	return flags.Args(), nil
+}
+
+// FileInfo is the JSON output of ls and stat.
+type FileInfo struct {
+	Name   string    `json:"name"`
+	Mode   string    `json:"mode"`
+	Perm   string    `json:"perm"`
+	Size   int64     `json:"size"`
+	Mtime  time.Time `json:"mtime"`
+	Uid    int       `json:"uid"`
+	Gid    int       `json:"gid"`
+	Target string    `json:"target,omitempty"`
+}
+
+func newFileInfo(fs *aferoguestfs.Fs, path string, info os.FileInfo) (*FileInfo, error) {
+	ret := &FileInfo{
+		Name:  info.Name(),
+		Mode:  info.Mode().String(),
+		Perm:  fmt.Sprintf("%04o", info.Mode().Perm()),
+		Size:  info.Size(),
+		Mtime: info.ModTime().UTC(),
+	}
+
+	if o, ok := info.(interface {
+		Uid() int
+		Gid() int
+	}); ok {
+		ret.Uid, ret.Gid = o.Uid(), o.Gid()
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := fs.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		ret.Target = target
+	}
+
+	return ret, nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func runLs(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("ls", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	dir, err := fs.Open(args[0])
+	if err != nil {
+		return err
+	}
+	names, err := dir.Readdirnames(0)
+	dir.Close()
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	ret := make([]*FileInfo, 0, len(names))
+	for _, n := range names {
+		path := filepath.Join(args[0], n)
+		info, err := fs.Lstat(path)
+		if err != nil {
+			return err
+		}
+		fi, err := newFileInfo(fs, path, info)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, fi)
+	}
+
+	return printJSON(ret)
+}
+
+func runCat(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("cat", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	bs, err := afero.ReadFile(fs, args[0])
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(bs)
+	return err
+}
+
+func runPut(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	flags := flag.NewFlagSet("put", flag.ContinueOnError)
+	mode := flags.String("m", "0644", "mode of a new file")
+	args, err := parseArgs(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	perm, err := parseMode(*mode)
+	if err != nil {
+		return err
+	}
+
+	bs, err := readLocal(args[0])
+	if err != nil {
+		return err
+	}
+
+	return afero.WriteFile(fs, args[1], bs, perm)
+}
+
+func runGet(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("get", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	bs, err := afero.ReadFile(fs, args[0])
+	if err != nil {
+		return err
+	}
+
+	if args[1] == "-" {
+		_, err = os.Stdout.Write(bs)
+		return err
+	}
+
+	return os.WriteFile(args[1], bs, 0644)
+}
+
+func runRm(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+	recursive := flags.Bool("r", false, "remove directories and their contents")
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if *recursive {
+		return fs.RemoveAll(args[0])
+	}
+	return fs.Remove(args[0])
+}
+
+func runMkdir(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	flags := flag.NewFlagSet("mkdir", flag.ContinueOnError)
+	parents := flags.Bool("p", false, "create missing parents")
+	mode := flags.String("m", "0755", "mode of the directory")
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	perm, err := parseMode(*mode)
+	if err != nil {
+		return err
+	}
+
+	if *parents {
+		return fs.MkdirAll(args[0], perm)
+	}
+	return fs.Mkdir(args[0], perm)
+}
+
+func runChmod(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("chmod", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	perm, err := parseMode(args[0])
+	if err != nil {
+		return err
+	}
+
+	return fs.Chmod(args[1], perm)
+}
+
+func runChown(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	flags := flag.NewFlagSet("chown", flag.ContinueOnError)
+	noDereference := flags.Bool("h", false, "change symlinks instead of the files they point to")
+	args, err := parseArgs(flags, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	uid, gid, err := parseOwner(args[0])
+	if err != nil {
+		return err
+	}
+
+	if *noDereference {
+		return fs.Lchown(args[1], uid, gid)
+	}
+	return fs.Chown(args[1], uid, gid)
+}
+
+func runStat(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("stat", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	info, err := fs.Lstat(args[0])
+	if err != nil {
+		return err
+	}
+
+	fi, err := newFileInfo(fs, args[0], info)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(fi)
+}
+
+func runTarOut(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("tar-out", flag.ContinueOnError), args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 1 || args[1] == "-" {
+		return fs.TarOut(args[0], os.Stdout)
+	}
+
+	f, err := os.Create(args[1])
+	if err != nil {
+		return err
+	}
+
+	err = fs.TarOut(args[0], f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func runTarIn(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("tar-in", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "-" {
+		return fs.TarIn(os.Stdin, args[1])
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return fs.TarIn(f, args[1])
+}
+
+func runChecksum(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	flags := flag.NewFlagSet("checksum", flag.ContinueOnError)
+	algo := flags.String("a", string(aferoguestfs.SHA256), "algorithm: crc, md5, sha1, sha224, sha256, sha384 or sha512")
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	info, err := fs.Stat(args[0])
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		digest, err := fs.Checksum(aferoguestfs.ChecksumAlgo(*algo), args[0])
+		if err != nil {
+			return err
+		}
+		return printJSON(aferoguestfs.ManifestEntry{Path: args[0], Digest: digest})
+	}
+
+	entries := []aferoguestfs.ManifestEntry{}
+	err = fs.Manifest(args[0], aferoguestfs.ChecksumAlgo(*algo), func(e aferoguestfs.ManifestEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return printJSON(entries)
+}
+
+func runDiff(o *opener, fs *aferoguestfs.Fs, args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	opts := &aferoguestfs.DiffOptions{}
+	flags.StringVar(&opts.Dir, "dir", "/", "directory to compare")
+	flags.BoolVar(&opts.Content, "content", false, "compare file contents")
+	flags.BoolVar(&opts.Xattrs, "xattrs", false, "compare extended attributes")
+	flags.BoolVar(&opts.IgnoreMtime, "ignore-mtime", false, "ignore modification times")
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	other, err := o.open(args[0])
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+
+	report, err := aferoguestfs.Diff(fs, other.Fs, opts)
+	if err != nil {
+		return err
+	}
+
+	return report.WriteJSON(os.Stdout)
+}
+
+// readLocal reads a host file, or stdin for "-".
+func readLocal(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// parseMode parses an octal mode such as "0644".
+func parseMode(s string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 07777 {
+		return 0, fmt.Errorf("invalid mode %q", s)
+	}
+
+	mode := os.FileMode(m & 0777)
+	if m&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// parseOwner parses "uid:gid".
+func parseOwner(s string) (int, int, error) {
+	u, g, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid owner %q, expected uid:gid", s)
+	}
+
+	uid, err := strconv.Atoi(u)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid uid %q", u)
+	}
+
+	gid, err := strconv.Atoi(g)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid gid %q", g)
+	}
+
+	return uid, gid, nil
+}
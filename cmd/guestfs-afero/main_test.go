@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMode(t *testing.T) {
+	mode, err := parseMode("0644")
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), mode)
+
+	mode, err = parseMode("4755")
+	require.Nil(t, err)
+	assert.Equal(t, os.ModeSetuid|0755, mode)
+
+	_, err = parseMode("0999")
+	assert.NotNil(t, err)
+
+	_, err = parseMode("17777")
+	assert.NotNil(t, err)
+}
+
+func TestParseOwner(t *testing.T) {
+	uid, gid, err := parseOwner("1000:100")
+	require.Nil(t, err)
+	assert.Equal(t, 1000, uid)
+	assert.Equal(t, 100, gid)
+
+	_, _, err = parseOwner("1000")
+	assert.NotNil(t, err)
+
+	_, _, err = parseOwner("root:root")
+	assert.NotNil(t, err)
+}
+
+func TestRunUsage(t *testing.T) {
+	assert.NotNil(t, run([]string{}))
+	assert.NotNil(t, run([]string{"-a", "disk.img", "unknown"}))
+}
+
+// newImage copies the test image of the library to a temp file and returns its
+// path. It has an ext4 filesystem on /dev/sda2.
+func newImage(t *testing.T) string {
+	bs, err := os.ReadFile("../../testdata/test1.img")
+	require.Nil(t, err)
+
+	image := filepath.Join(t.TempDir(), "test1.img")
+	require.Nil(t, os.WriteFile(image, bs, 0644))
+	return image
+}
+
+// runStdout runs the command with args and returns what it printed.
+func runStdout(t *testing.T, args ...string) (string, error) {
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	require.Nil(t, err)
+	defer f.Close()
+
+	stdout := os.Stdout
+	os.Stdout = f
+	err = run(args)
+	os.Stdout = stdout
+
+	_, seekErr := f.Seek(0, io.SeekStart)
+	require.Nil(t, seekErr)
+	bs, readErr := io.ReadAll(f)
+	require.Nil(t, readErr)
+
+	return string(bs), err
+}
+
+func TestRunCommands(t *testing.T) {
+	image := newImage(t)
+	global := []string{"-a", image, "-p", "/dev/sda2"}
+	cmd := func(args ...string) (string, error) {
+		return runStdout(t, append(append([]string{}, global...), args...)...)
+	}
+
+	local := filepath.Join(t.TempDir(), "local.txt")
+	require.Nil(t, os.WriteFile(local, []byte("some text"), 0644))
+
+	_, err := cmd("mkdir", "-p", "-m", "0750", "/dir/sub")
+	require.Nil(t, err)
+
+	_, err = cmd("put", "-m", "0600", local, "/dir/test.txt")
+	require.Nil(t, err)
+
+	out, err := cmd("cat", "/dir/test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "some text", out)
+
+	_, err = cmd("chmod", "0640", "/dir/test.txt")
+	require.Nil(t, err)
+
+	_, err = cmd("chown", "1000:100", "/dir/test.txt")
+	require.Nil(t, err)
+
+	out, err = cmd("stat", "/dir/test.txt")
+	require.Nil(t, err)
+	var fi FileInfo
+	require.Nil(t, json.Unmarshal([]byte(out), &fi))
+	assert.Equal(t, "test.txt", fi.Name)
+	assert.Equal(t, "0640", fi.Perm)
+	assert.Equal(t, int64(9), fi.Size)
+	assert.Equal(t, 1000, fi.Uid)
+	assert.Equal(t, 100, fi.Gid)
+
+	out, err = cmd("ls", "/dir")
+	require.Nil(t, err)
+	var fis []FileInfo
+	require.Nil(t, json.Unmarshal([]byte(out), &fis))
+	require.Len(t, fis, 2)
+	assert.Equal(t, "sub", fis[0].Name)
+	assert.Equal(t, "0750", fis[0].Perm)
+	assert.Equal(t, "test.txt", fis[1].Name)
+
+	got := filepath.Join(t.TempDir(), "got.txt")
+	_, err = cmd("get", "/dir/test.txt", got)
+	require.Nil(t, err)
+	bs, err := os.ReadFile(got)
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(bs))
+
+	_, err = cmd("rm", "/dir/test.txt")
+	require.Nil(t, err)
+	_, err = cmd("rm", "/dir")
+	assert.NotNil(t, err)
+	_, err = cmd("rm", "-r", "/dir")
+	require.Nil(t, err)
+
+	_, err = cmd("stat", "/dir")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunReadOnly(t *testing.T) {
+	image := newImage(t)
+	local := filepath.Join(t.TempDir(), "local.txt")
+	require.Nil(t, os.WriteFile(local, []byte("some text"), 0644))
+
+	_, err := runStdout(t, "-a", image, "-p", "/dev/sda2", "-ro", "put", local, "/test.txt")
+	assert.NotNil(t, err)
+
+	_, err = runStdout(t, "-a", image, "-p", "/dev/sda2", "-ro", "ls", "/")
+	assert.Nil(t, err)
+
+	_, err = runStdout(t, "-a", image, "-p", "/dev/sda2", "stat", "/test.txt")
+	assert.True(t, os.IsNotExist(err))
+
+	// the image file itself isn't written to
+	before, err := os.ReadFile(image)
+	require.Nil(t, err)
+	_, err = runStdout(t, "-a", image, "-p", "/dev/sda2", "-ro", "ls", "/")
+	require.Nil(t, err)
+	after, err := os.ReadFile(image)
+	require.Nil(t, err)
+	assert.True(t, bytes.Equal(before, after))
+}
+
+func TestRunChownSymlink(t *testing.T) {
+	image := newImage(t)
+
+	fsys, err := aferoguestfs.OpenPartitionFs(image, "/dev/sda2")
+	require.Nil(t, err)
+	require.Nil(t, afero.WriteFile(fsys, "/test.txt", []byte("some text"), 0644))
+	require.Nil(t, fsys.SymlinkIfPossible("test.txt", "/link"))
+	require.Nil(t, fsys.Close())
+
+	stat := func(name string) FileInfo {
+		out, err := runStdout(t, "-a", image, "-p", "/dev/sda2", "stat", name)
+		require.Nil(t, err)
+		var fi FileInfo
+		require.Nil(t, json.Unmarshal([]byte(out), &fi))
+		return fi
+	}
+
+	// like chown(1), symlinks are followed unless -h is given
+	_, err = runStdout(t, "-a", image, "-p", "/dev/sda2", "chown", "1000:100", "/link")
+	require.Nil(t, err)
+	assert.Equal(t, 1000, stat("/test.txt").Uid)
+
+	_, err = runStdout(t, "-a", image, "-p", "/dev/sda2", "chown", "-h", "2000:200", "/link")
+	require.Nil(t, err)
+	assert.Equal(t, 1000, stat("/test.txt").Uid)
+}
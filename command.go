@@ -0,0 +1,240 @@
+package aferoguestfs
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CommandOptions configure Fs.Command.
+type CommandOptions struct {
+	// Env is added to the environment of the command, in "key=value" form.
+	Env []string
+
+	// Dir is the working directory of the command. Defaults to "/".
+	Dir string
+
+	// Timeout kills the command if it runs longer. It is shortened to the
+	// deadline of the context, if any. Requires timeout(1) in the guest.
+	Timeout time.Duration
+
+	// Shell is the shell in the guest used to run the command. Defaults to
+	// "/bin/sh".
+	Shell string
+}
+
+// CommandResult is the output of a command run by Fs.Command.
+type CommandResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// ExitError is returned by Fs.Command when the command exits with a non-zero
+// status.
+type ExitError struct {
+	ExitCode int
+	Stderr   []byte
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d: %s", e.ExitCode, strings.TrimSpace(string(e.Stderr)))
+}
+
+// timeoutKilledStatus is the exit status of timeout(1) -s KILL when the
+// command timed out.
+const timeoutKilledStatus = 137
+
+// Command runs argv inside the guest, chrooted into the root of the
+// filesystem. The guest's binaries run on the appliance kernel, so the guest
+// architecture must match the appliance's.
+//
+// The command runs synchronously in the appliance. A timeout, taken from
+// opts.Timeout or the deadline of ctx, whichever is earlier, is enforced by
+// timeout(1) in the guest, which must then provide it. Canceling ctx without
+// a deadline doesn't interrupt a running command.
+//
+// The guest must have a writable /tmp to capture stderr and the exit status.
+// If the command exits with a non-zero status, the result is returned
+// together with an *ExitError.
+func (fs *Fs) Command(ctx context.Context, argv []string, opts *CommandOptions) (*CommandResult, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	if opts == nil {
+		opts = &CommandOptions{}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	shell := opts.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	if err := fs.checkArchitecture(shell); err != nil {
+		return nil, err
+	}
+
+	timeout := opts.Timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if d := time.Until(deadline); timeout == 0 || d < timeout {
+			timeout = d
+		}
+		if timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+
+	tmpDir, err := fs.guestfs.Mkdtemp("/tmp/afero-guestfs-command-XXXXXX")
+	if err != nil {
+		return nil, wrapErr(err, "/tmp")
+	}
+	defer fs.guestfs.Rm_rf(tmpDir)
+
+	stderrFile := tmpDir + "/stderr"
+	statusFile := tmpDir + "/status"
+	script := commandScript(argv, opts.Dir, opts.Env, timeout, stderrFile, statusFile)
+
+	fs.invalidateAll()
+	start := time.Now()
+	stdout, err := fs.guestfs.Sh(shell + " -c " + shellQuote(script))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", argv[0], err)
+	}
+	elapsed := time.Since(start)
+
+	stderr, err := fs.guestfs.Read_file(stderrFile)
+	if err != nil {
+		return nil, wrapErr(err, stderrFile)
+	}
+
+	status, err := fs.guestfs.Read_file(statusFile)
+	if err != nil {
+		return nil, wrapErr(err, statusFile)
+	}
+
+	exitCode, err := strconv.Atoi(strings.TrimSpace(string(status)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse exit status of %s: %w", argv[0], err)
+	}
+
+	res := &CommandResult{
+		Stdout:   []byte(stdout),
+		Stderr:   stderr,
+		ExitCode: exitCode,
+	}
+
+	// a command killed by SIGKILL before the timeout passed wasn't killed by
+	// timeout(1)
+	if timeout > 0 && exitCode == timeoutKilledStatus && elapsed >= timeout {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		return res, fmt.Errorf("%s timed out after %s", argv[0], timeout)
+	}
+
+	if exitCode != 0 {
+		return res, &ExitError{ExitCode: exitCode, Stderr: stderr}
+	}
+
+	return res, nil
+}
+
+// CommandLines is like Command but returns stdout split into lines.
+func (fs *Fs) CommandLines(ctx context.Context, argv []string, opts *CommandOptions) ([]string, error) {
+	res, err := fs.Command(ctx, argv, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := strings.TrimSuffix(string(res.Stdout), "\n")
+	if out == "" {
+		return []string{}, nil
+	}
+
+	return strings.Split(out, "\n"), nil
+}
+
+// checkArchitecture fails if the guest binary name can't run on the
+// appliance kernel.
+func (fs *Fs) checkArchitecture(name string) error {
+	guestArch, err := fs.guestfs.File_architecture(name)
+	if err != nil {
+		return fmt.Errorf("failed to get architecture of %s: %w", name, wrapErr(err, name))
+	}
+
+	uts, err := fs.guestfs.Utsname()
+	if err != nil {
+		return fmt.Errorf("failed to get appliance architecture: %w", err)
+	}
+
+	if !archCompatible(normalizeArch(guestArch), normalizeArch(uts.Uts_machine)) {
+		return fmt.Errorf("guest architecture %s can't run on appliance architecture %s", guestArch, uts.Uts_machine)
+	}
+
+	return nil
+}
+
+var i386Re = regexp.MustCompile(`^i[3-6]86$`)
+
+func normalizeArch(arch string) string {
+	if i386Re.MatchString(arch) {
+		return "i386"
+	}
+	return arch
+}
+
+// archCompatible reports whether binaries of guest architecture run on a
+// kernel of appliance architecture.
+func archCompatible(guest string, appliance string) bool {
+	switch {
+	case guest == appliance:
+		return true
+	case guest == "i386" && appliance == "x86_64":
+		return true
+	case guest == "arm" && appliance == "aarch64":
+		return true
+	}
+	return false
+}
+
+// commandScript returns a shell script running argv that writes its stderr to
+// stderrFile and its exit status to statusFile.
+func commandScript(argv []string, dir string, env []string, timeout time.Duration, stderrFile string, statusFile string) string {
+	var cmd []string
+
+	if timeout > 0 {
+		secs := int64(math.Ceil(timeout.Seconds()))
+		cmd = append(cmd, "timeout", "-s", "KILL", strconv.FormatInt(secs, 10))
+	}
+
+	if len(env) > 0 {
+		cmd = append(cmd, "env")
+		cmd = append(cmd, env...)
+	}
+
+	cmd = append(cmd, argv...)
+
+	for i, c := range cmd {
+		cmd[i] = shellQuote(c)
+	}
+
+	if dir == "" {
+		dir = "/"
+	}
+
+	return fmt.Sprintf("{ cd %s && %s; } 2>%s; echo $? >%s",
+		shellQuote(dir), strings.Join(cmd, " "), shellQuote(stderrFile), shellQuote(statusFile))
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
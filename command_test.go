@@ -0,0 +1,162 @@
+package aferoguestfs_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var lddPathRe = regexp.MustCompile(`(/\S+) \(0x`)
+
+// newShellImage creates an image with the host's /bin/sh, sleep and timeout
+// and their shared libraries on /dev/sda1, enough to run shell scripts in the
+// guest.
+func newShellImage(t *testing.T) string {
+	files := map[string]string{"/bin/sh": "/bin/sh"}
+	bins := []string{"/bin/sh"}
+
+	for _, name := range []string{"sleep", "timeout"} {
+		bin, err := exec.LookPath(name)
+		require.Nil(t, err)
+		files["/bin/"+name] = bin
+		bins = append(bins, bin)
+	}
+
+	for _, bin := range bins {
+		out, err := exec.Command("ldd", bin).Output()
+		require.Nil(t, err)
+		for _, m := range lddPathRe.FindAllStringSubmatch(string(out), -1) {
+			files[m[1]] = m[1]
+		}
+	}
+
+	return newImage(t, 64*1024*1024, func(g *guestfs.Guestfs) error {
+		if err := g.Part_disk("/dev/sda", "mbr"); err != nil {
+			return err
+		}
+		if err := g.Mkfs("ext4", "/dev/sda1", nil); err != nil {
+			return err
+		}
+		if err := g.Mount("/dev/sda1", "/"); err != nil {
+			return err
+		}
+		if err := g.Mkdir_mode("/tmp", 01777); err != nil {
+			return err
+		}
+		for dst, src := range files {
+			if err := g.Mkdir_p(filepath.Dir(dst)); err != nil {
+				return err
+			}
+			if err := g.Upload(src, dst); err != nil {
+				return err
+			}
+			if err := g.Chmod(0755, dst); err != nil {
+				return err
+			}
+		}
+		return g.Umount_all()
+	})
+}
+
+func newShellFs(t *testing.T) *aferoguestfs.PartitionFs {
+	fsys, err := aferoguestfs.OpenPartitionFs(newShellImage(t), "/dev/sda1")
+	require.Nil(t, err)
+	t.Cleanup(func() { fsys.Close() })
+	return fsys
+}
+
+func TestCommand(t *testing.T) {
+	fsys := newShellFs(t)
+
+	res, err := fsys.Command(context.Background(), []string{"echo", "hello"}, nil)
+	require.Nil(t, err)
+	assert.Equal(t, "hello\n", string(res.Stdout))
+	assert.Equal(t, 0, res.ExitCode)
+
+	lines, err := fsys.CommandLines(context.Background(), []string{"sh", "-c", "echo $A; pwd"}, &aferoguestfs.CommandOptions{
+		Env: []string{"A=b"},
+		Dir: "/tmp",
+	})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"b", "/tmp"}, lines)
+}
+
+func TestCommandExitStatus(t *testing.T) {
+	fsys := newShellFs(t)
+
+	res, err := fsys.Command(context.Background(), []string{"sh", "-c", "echo oops >&2; exit 3"}, nil)
+	var exitErr *aferoguestfs.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode)
+	assert.Equal(t, "oops\n", string(res.Stderr))
+
+	// killed by a signal, but not because of the timeout
+	_, err = fsys.Command(context.Background(), []string{"sh", "-c", "kill -KILL $$"}, &aferoguestfs.CommandOptions{
+		Timeout: time.Minute,
+	})
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 137, exitErr.ExitCode)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	fsys := newShellFs(t)
+
+	start := time.Now()
+	_, err := fsys.Command(context.Background(), []string{"sleep", "60"}, &aferoguestfs.CommandOptions{
+		Timeout: 500 * time.Millisecond,
+	})
+	assert.NotNil(t, err)
+	assert.False(t, errors.As(err, new(*aferoguestfs.ExitError)))
+	assert.Less(t, time.Since(start), 30*time.Second)
+}
+
+func TestCommandDeadline(t *testing.T) {
+	fsys := newShellFs(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := fsys.Command(ctx, []string{"sleep", "60"}, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 30*time.Second)
+}
+
+func TestCommandNoShell(t *testing.T) {
+	clear(t, gfs)
+
+	// the test image has no operating system to run commands with
+	_, err := gfs.Command(context.Background(), []string{"true"}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCommandEmpty(t *testing.T) {
+	_, err := gfs.Command(context.Background(), nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCommandCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := gfs.Command(ctx, []string{"true"}, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestExitError(t *testing.T) {
+	err := &aferoguestfs.ExitError{
+		ExitCode: 2,
+		Stderr:   []byte("ls: cannot access 'x': No such file or directory\n"),
+	}
+
+	assert.Equal(t, "exit status 2: ls: cannot access 'x': No such file or directory", err.Error())
+}
@@ -0,0 +1,233 @@
+package aferoguestfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ChangeType is the kind of a Change.
+type ChangeType string
+
+// Change types.
+const (
+	Added    ChangeType = "added"
+	Removed  ChangeType = "removed"
+	Modified ChangeType = "modified"
+)
+
+// Fields compared by Diff.
+const (
+	FieldMode    = "mode"
+	FieldUid     = "uid"
+	FieldGid     = "gid"
+	FieldSize    = "size"
+	FieldMtime   = "mtime"
+	FieldTarget  = "target"
+	FieldXattrs  = "xattrs"
+	FieldContent = "content"
+)
+
+// DiffOptions configure Diff.
+type DiffOptions struct {
+	// Dir is the directory compared in both filesystems. Defaults to "/".
+	Dir string
+
+	// Xattrs compares extended attributes.
+	Xattrs bool
+
+	// Content compares the SHA-256 checksums of regular files that have the
+	// same size.
+	Content bool
+
+	// IgnoreMtime doesn't report modification time differences.
+	IgnoreMtime bool
+}
+
+// EntryInfo describes a file in a DiffReport.
+type EntryInfo struct {
+	Mode   string            `json:"mode"`
+	Uid    int64             `json:"uid"`
+	Gid    int64             `json:"gid"`
+	Size   int64             `json:"size"`
+	Mtime  time.Time         `json:"mtime"`
+	Target string            `json:"target,omitempty"`
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+	Digest string            `json:"digest,omitempty"`
+}
+
+// Change is a difference between two filesystems.
+type Change struct {
+	// Path is relative to DiffOptions.Dir.
+	Path string     `json:"path"`
+	Type ChangeType `json:"type"`
+
+	// Fields lists the differing fields of a Modified entry.
+	Fields []string `json:"fields,omitempty"`
+
+	Old *EntryInfo `json:"old,omitempty"`
+	New *EntryInfo `json:"new,omitempty"`
+}
+
+// DiffReport lists the changes between two filesystems ordered by path.
+type DiffReport struct {
+	Changes []Change `json:"changes"`
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *DiffReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Diff compares the trees of a and b and reports the files that were added
+// in b, removed from a, or modified.
+func Diff(a *Fs, b *Fs, opts *DiffOptions) (*DiffReport, error) {
+	if opts == nil {
+		opts = &DiffOptions{}
+	}
+
+	dir := opts.Dir
+	if dir == "" {
+		dir = "/"
+	}
+
+	aEntries, err := a.collectTree(dir, opts.Xattrs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk old tree: %w", err)
+	}
+
+	bEntries, err := b.collectTree(dir, opts.Xattrs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk new tree: %w", err)
+	}
+
+	paths := make([]string, 0, len(aEntries)+len(bEntries))
+	for p := range aEntries {
+		paths = append(paths, p)
+	}
+	for p := range bEntries {
+		if _, ok := aEntries[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	report := &DiffReport{Changes: []Change{}}
+	for _, p := range paths {
+		ae, aok := aEntries[p]
+		be, bok := bEntries[p]
+
+		switch {
+		case !bok:
+			report.Changes = append(report.Changes, Change{Path: p, Type: Removed, Old: ae.entryInfo()})
+		case !aok:
+			report.Changes = append(report.Changes, Change{Path: p, Type: Added, New: be.entryInfo()})
+		default:
+			c, err := diffEntries(a, b, filepath.Join(dir, p), ae, be, opts)
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				c.Path = p
+				report.Changes = append(report.Changes, *c)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// collectTree returns every file below dir keyed by its relative path.
+func (fs *Fs) collectTree(dir string, withXattrs bool) (map[string]*treeEntry, error) {
+	ret := map[string]*treeEntry{}
+	err := fs.walkTree(dir, withXattrs, func(rel string, e *treeEntry) error {
+		ret[rel] = e
+		return nil
+	})
+	return ret, err
+}
+
+// diffEntries compares two versions of the file at path. It returns nil if
+// they don't differ.
+func diffEntries(a *Fs, b *Fs, path string, ae *treeEntry, be *treeEntry, opts *DiffOptions) (*Change, error) {
+	as, bs := ae.info.stat, be.info.stat
+	oldInfo, newInfo := ae.entryInfo(), be.entryInfo()
+
+	var fields []string
+	if ae.info.Mode() != be.info.Mode() {
+		fields = append(fields, FieldMode)
+	}
+	if as.St_uid != bs.St_uid {
+		fields = append(fields, FieldUid)
+	}
+	if as.St_gid != bs.St_gid {
+		fields = append(fields, FieldGid)
+	}
+	if as.St_size != bs.St_size {
+		fields = append(fields, FieldSize)
+	}
+	if !opts.IgnoreMtime && !ae.info.ModTime().Equal(be.info.ModTime()) {
+		fields = append(fields, FieldMtime)
+	}
+	if ae.target != be.target {
+		fields = append(fields, FieldTarget)
+	}
+	if opts.Xattrs && !equalXattrs(ae.xattrs, be.xattrs) {
+		fields = append(fields, FieldXattrs)
+	}
+
+	if opts.Content && ae.info.Mode().IsRegular() && be.info.Mode().IsRegular() && as.St_size == bs.St_size {
+		var err error
+		if oldInfo.Digest, err = a.Checksum(SHA256, path); err != nil {
+			return nil, err
+		}
+		if newInfo.Digest, err = b.Checksum(SHA256, path); err != nil {
+			return nil, err
+		}
+		if oldInfo.Digest != newInfo.Digest {
+			fields = append(fields, FieldContent)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	return &Change{
+		Type:   Modified,
+		Fields: fields,
+		Old:    oldInfo,
+		New:    newInfo,
+	}, nil
+}
+
+func (e *treeEntry) entryInfo() *EntryInfo {
+	return &EntryInfo{
+		Mode:   e.info.Mode().String(),
+		Uid:    e.info.stat.St_uid,
+		Gid:    e.info.stat.St_gid,
+		Size:   e.info.stat.St_size,
+		Mtime:  e.info.ModTime().UTC(),
+		Target: e.target,
+		Xattrs: e.xattrs,
+	}
+}
+
+func equalXattrs(a map[string][]byte, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, av := range a {
+		bv, ok := b[k]
+		if !ok || !bytes.Equal(av, bv) {
+			return false
+		}
+	}
+	return true
+}
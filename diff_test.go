@@ -0,0 +1,81 @@
+package aferoguestfs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	aImage := newTest1Image(t)
+	bImage := newTest1Image(t)
+
+	a, err := aferoguestfs.OpenPartitionFs(aImage, "/dev/sda2")
+	require.Nil(t, err)
+	defer a.Close()
+
+	b, err := aferoguestfs.OpenPartitionFs(bImage, "/dev/sda2")
+	require.Nil(t, err)
+	defer b.Close()
+
+	for _, fsys := range []afero.Fs{a, b} {
+		require.Nil(t, fsys.Mkdir("/etc", 0755))
+		require.Nil(t, afero.WriteFile(fsys, "/etc/same.txt", []byte("some text"), 0644))
+		require.Nil(t, afero.WriteFile(fsys, "/etc/content.txt", []byte("some text"), 0644))
+		require.Nil(t, afero.WriteFile(fsys, "/etc/mode.txt", []byte("some text"), 0644))
+	}
+
+	require.Nil(t, afero.WriteFile(a, "/etc/removed.txt", []byte("some text"), 0644))
+	require.Nil(t, afero.WriteFile(b, "/etc/added.txt", []byte("some text"), 0644))
+	require.Nil(t, afero.WriteFile(b, "/etc/content.txt", []byte("same size"), 0644))
+	require.Nil(t, b.Chmod("/etc/mode.txt", 0600))
+
+	report, err := aferoguestfs.Diff(a.Fs, b.Fs, &aferoguestfs.DiffOptions{
+		Dir:         "/etc",
+		Content:     true,
+		IgnoreMtime: true,
+	})
+	require.Nil(t, err)
+
+	type change struct {
+		Path   string
+		Type   aferoguestfs.ChangeType
+		Fields []string
+	}
+	actual := []change{}
+	for _, c := range report.Changes {
+		actual = append(actual, change{Path: c.Path, Type: c.Type, Fields: c.Fields})
+	}
+
+	assert.Equal(t, []change{
+		{Path: "added.txt", Type: aferoguestfs.Added},
+		{Path: "content.txt", Type: aferoguestfs.Modified, Fields: []string{aferoguestfs.FieldContent}},
+		{Path: "mode.txt", Type: aferoguestfs.Modified, Fields: []string{aferoguestfs.FieldMode}},
+		{Path: "removed.txt", Type: aferoguestfs.Removed},
+	}, actual)
+
+	buf := bytes.NewBuffer(nil)
+	require.Nil(t, report.WriteJSON(buf))
+
+	var decoded aferoguestfs.DiffReport
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Len(t, decoded.Changes, 4)
+	assert.Equal(t, "-rw-------", decoded.Changes[2].New.Mode)
+}
+
+func TestDiffIdentical(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, afero.WriteFile(gfs, "test.txt", []byte("some text"), os.ModePerm))
+	require.Nil(t, gfs.Symlink("test.txt", "link"))
+
+	report, err := aferoguestfs.Diff(gfs, gfs, nil)
+	require.Nil(t, err)
+	assert.Empty(t, report.Changes)
+}
@@ -0,0 +1,272 @@
+package aferoguestfs
+
+import (
+	"fmt"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// Partition describes a single partition of a Disk.
+//
+// Start, End and Size are in bytes. Fields that only apply to one partition
+// table type are left empty for the other: Type, GUID, Name and Attributes are
+// only set for GPT disks, MBRID and MBRType only for MBR disks.
+type Partition struct {
+	Number int
+	Device string
+	Start  uint64
+	End    uint64
+	Size   uint64
+
+	// Type is the partition type GUID of a GPT partition.
+	Type string
+	// GUID is the unique GUID of a GPT partition.
+	GUID string
+	// Name is the label of a GPT partition.
+	Name string
+	// Attributes are the attribute flags of a GPT partition.
+	Attributes int64
+
+	// MBRID is the partition type byte of an MBR partition.
+	MBRID int
+	// MBRType is one of "primary", "extended" or "logical".
+	MBRType string
+
+	Bootable bool
+}
+
+// Disk manages the partition table of a block device.
+type Disk struct {
+	guestfs *guestfs.Guestfs
+	device  string
+}
+
+// NewDisk returns a Disk for a block device, e.g. "/dev/sda".
+func NewDisk(g *guestfs.Guestfs, device string) *Disk {
+	return &Disk{
+		guestfs: g,
+		device:  device,
+	}
+}
+
+// Device returns the block device of the disk.
+func (d *Disk) Device() string {
+	return d.device
+}
+
+// PartitionTableType returns the partition table type, e.g. "msdos" or "gpt".
+func (d *Disk) PartitionTableType() (string, error) {
+	parttype, err := d.guestfs.Part_get_parttype(d.device)
+	if err != nil {
+		return "", fmt.Errorf("failed to get partition table type of %s: %w", d.device, err)
+	}
+	return parttype, nil
+}
+
+// SectorSize returns the sector size of the disk in bytes.
+func (d *Disk) SectorSize() (int, error) {
+	ss, err := d.guestfs.Blockdev_getss(d.device)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get sector size of %s: %w", d.device, err)
+	}
+	return ss, nil
+}
+
+// Init creates a new empty partition table of type parttype ("msdos" or
+// "gpt"), destroying any existing partitions.
+func (d *Disk) Init(parttype string) error {
+	if err := d.guestfs.Part_init(d.device, parttype); err != nil {
+		return fmt.Errorf("failed to create partition table on %s: %w", d.device, err)
+	}
+	return nil
+}
+
+// Partitions returns all partitions of the disk ordered by number.
+func (d *Disk) Partitions() ([]Partition, error) {
+	parttype, err := d.PartitionTableType()
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := d.guestfs.Part_list(d.device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions on %s: %w", d.device, err)
+	}
+
+	devices, err := d.partitionDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]Partition, 0, len(*parts))
+	for _, p := range *parts {
+		part := Partition{
+			Number: int(p.Part_num),
+			Device: devices[int(p.Part_num)],
+			Start:  p.Part_start,
+			End:    p.Part_end,
+			Size:   p.Part_size,
+		}
+
+		if err := d.readAttributes(&part, parttype); err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, part)
+	}
+
+	return ret, nil
+}
+
+// Partition returns the partition with number partnum.
+func (d *Disk) Partition(partnum int) (*Partition, error) {
+	parts, err := d.Partitions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range parts {
+		if p.Number == partnum {
+			return &p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("partition %d not found on %s", partnum, d.device)
+}
+
+// AddPartition adds a partition spanning sectors startsect to endsect
+// inclusive. Negative endsect counts back from the end of the disk. prlogex
+// is one of "primary", "logical" or "extended"; GPT disks only accept
+// "primary".
+func (d *Disk) AddPartition(prlogex string, startsect int64, endsect int64) error {
+	if err := d.guestfs.Part_add(d.device, prlogex, startsect, endsect); err != nil {
+		return fmt.Errorf("failed to add partition to %s: %w", d.device, err)
+	}
+	return nil
+}
+
+// DeletePartition deletes the partition with number partnum.
+func (d *Disk) DeletePartition(partnum int) error {
+	if err := d.guestfs.Part_del(d.device, partnum); err != nil {
+		return fmt.Errorf("failed to delete partition %d on %s: %w", partnum, d.device, err)
+	}
+	return nil
+}
+
+// ResizePartition moves the end of partition partnum to sector endsect. The
+// filesystem on the partition is not resized.
+func (d *Disk) ResizePartition(partnum int, endsect int64) error {
+	if err := d.guestfs.Part_resize(d.device, partnum, endsect); err != nil {
+		return fmt.Errorf("failed to resize partition %d on %s: %w", partnum, d.device, err)
+	}
+	return nil
+}
+
+// SetBootable sets the bootable flag of partition partnum.
+func (d *Disk) SetBootable(partnum int, bootable bool) error {
+	if err := d.guestfs.Part_set_bootable(d.device, partnum, bootable); err != nil {
+		return fmt.Errorf("failed to set bootable flag of partition %d on %s: %w", partnum, d.device, err)
+	}
+	return nil
+}
+
+// SetName sets the name of GPT partition partnum.
+func (d *Disk) SetName(partnum int, name string) error {
+	if err := d.guestfs.Part_set_name(d.device, partnum, name); err != nil {
+		return fmt.Errorf("failed to set name of partition %d on %s: %w", partnum, d.device, err)
+	}
+	return nil
+}
+
+// SetType sets the partition type GUID of GPT partition partnum.
+func (d *Disk) SetType(partnum int, guid string) error {
+	if err := d.guestfs.Part_set_gpt_type(d.device, partnum, guid); err != nil {
+		return fmt.Errorf("failed to set type of partition %d on %s: %w", partnum, d.device, err)
+	}
+	return nil
+}
+
+// SetGUID sets the unique GUID of GPT partition partnum.
+func (d *Disk) SetGUID(partnum int, guid string) error {
+	if err := d.guestfs.Part_set_gpt_guid(d.device, partnum, guid); err != nil {
+		return fmt.Errorf("failed to set guid of partition %d on %s: %w", partnum, d.device, err)
+	}
+	return nil
+}
+
+// SetAttributes sets the attribute flags of GPT partition partnum.
+func (d *Disk) SetAttributes(partnum int, attributes int64) error {
+	if err := d.guestfs.Part_set_gpt_attributes(d.device, partnum, attributes); err != nil {
+		return fmt.Errorf("failed to set attributes of partition %d on %s: %w", partnum, d.device, err)
+	}
+	return nil
+}
+
+// SetMBRID sets the partition type byte of MBR partition partnum.
+func (d *Disk) SetMBRID(partnum int, id int) error {
+	if err := d.guestfs.Part_set_mbr_id(d.device, partnum, id); err != nil {
+		return fmt.Errorf("failed to set mbr id of partition %d on %s: %w", partnum, d.device, err)
+	}
+	return nil
+}
+
+func (d *Disk) readAttributes(part *Partition, parttype string) error {
+	var err error
+
+	part.Bootable, err = d.guestfs.Part_get_bootable(d.device, part.Number)
+	if err != nil {
+		return fmt.Errorf("failed to get bootable flag of partition %d on %s: %w", part.Number, d.device, err)
+	}
+
+	switch parttype {
+	case "gpt":
+		if part.Type, err = d.guestfs.Part_get_gpt_type(d.device, part.Number); err != nil {
+			return fmt.Errorf("failed to get type of partition %d on %s: %w", part.Number, d.device, err)
+		}
+		if part.GUID, err = d.guestfs.Part_get_gpt_guid(d.device, part.Number); err != nil {
+			return fmt.Errorf("failed to get guid of partition %d on %s: %w", part.Number, d.device, err)
+		}
+		if part.Name, err = d.guestfs.Part_get_name(d.device, part.Number); err != nil {
+			return fmt.Errorf("failed to get name of partition %d on %s: %w", part.Number, d.device, err)
+		}
+		if part.Attributes, err = d.guestfs.Part_get_gpt_attributes(d.device, part.Number); err != nil {
+			return fmt.Errorf("failed to get attributes of partition %d on %s: %w", part.Number, d.device, err)
+		}
+	case "msdos":
+		if part.MBRID, err = d.guestfs.Part_get_mbr_id(d.device, part.Number); err != nil {
+			return fmt.Errorf("failed to get mbr id of partition %d on %s: %w", part.Number, d.device, err)
+		}
+		if part.MBRType, err = d.guestfs.Part_get_mbr_part_type(d.device, part.Number); err != nil {
+			return fmt.Errorf("failed to get mbr type of partition %d on %s: %w", part.Number, d.device, err)
+		}
+	}
+
+	return nil
+}
+
+// partitionDevices maps partition numbers of the disk to their devices.
+func (d *Disk) partitionDevices() (map[int]string, error) {
+	partitions, err := d.guestfs.List_partitions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+
+	ret := map[int]string{}
+	for _, p := range partitions {
+		dev, err := d.guestfs.Part_to_dev(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get device of %s: %w", p, err)
+		}
+		if dev != d.device {
+			continue
+		}
+
+		partnum, err := d.guestfs.Part_to_partnum(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partition number of %s: %w", p, err)
+		}
+		ret[partnum] = p
+	}
+
+	return ret, nil
+}
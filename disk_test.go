@@ -0,0 +1,106 @@
+package aferoguestfs_test
+
+import (
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskPartitions(t *testing.T) {
+	fsys, err := aferoguestfs.OpenPartitionFs(newTest1Image(t), "/dev/sda2")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	assert.Equal(t, "/dev/sda", fsys.Disk.Device())
+
+	parttype, err := fsys.Disk.PartitionTableType()
+	require.Nil(t, err)
+	assert.Equal(t, "msdos", parttype)
+
+	parts, err := fsys.Disk.Partitions()
+	require.Nil(t, err)
+	require.Len(t, parts, 2)
+
+	assert.Equal(t, 1, parts[0].Number)
+	assert.Equal(t, "/dev/sda1", parts[0].Device)
+	assert.Equal(t, "primary", parts[0].MBRType)
+	assert.Equal(t, parts[0].End-parts[0].Start+1, parts[0].Size)
+
+	assert.Equal(t, 2, parts[1].Number)
+	assert.Equal(t, "/dev/sda2", parts[1].Device)
+	assert.Greater(t, parts[1].Start, parts[0].End)
+}
+
+func TestDiskSetBootable(t *testing.T) {
+	fsys, err := aferoguestfs.OpenPartitionFs(newTest1Image(t), "/dev/sda2")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	err = fsys.Disk.SetBootable(1, true)
+	assert.Nil(t, err)
+
+	part, err := fsys.Disk.Partition(1)
+	require.Nil(t, err)
+	assert.True(t, part.Bootable)
+
+	err = fsys.Disk.SetMBRID(1, 0x0c)
+	assert.Nil(t, err)
+
+	part, err = fsys.Disk.Partition(1)
+	require.Nil(t, err)
+	assert.Equal(t, 0x0c, part.MBRID)
+}
+
+func TestDiskGPT(t *testing.T) {
+	g, err := guestfs.Create()
+	require.Nil(t, err)
+	defer g.Close()
+
+	require.Nil(t, g.Add_drive_scratch(64*1024*1024, nil))
+	require.Nil(t, g.Launch())
+
+	disk := aferoguestfs.NewDisk(g, "/dev/sda")
+	require.Nil(t, disk.Init("gpt"))
+
+	require.Nil(t, disk.AddPartition("primary", 2048, 4095))
+	require.Nil(t, disk.AddPartition("primary", 4096, 8191))
+	require.Nil(t, disk.ResizePartition(2, 16383))
+
+	const efiType = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+	const guid = "01234567-89AB-CDEF-0123-456789ABCDEF"
+	require.Nil(t, disk.SetName(1, "EFI"))
+	require.Nil(t, disk.SetType(1, efiType))
+	require.Nil(t, disk.SetGUID(1, guid))
+	require.Nil(t, disk.SetAttributes(1, 1<<2))
+
+	parttype, err := disk.PartitionTableType()
+	require.Nil(t, err)
+	assert.Equal(t, "gpt", parttype)
+
+	parts, err := disk.Partitions()
+	require.Nil(t, err)
+	require.Len(t, parts, 2)
+
+	assert.Equal(t, "/dev/sda1", parts[0].Device)
+	assert.Equal(t, "EFI", parts[0].Name)
+	assert.Equal(t, efiType, parts[0].Type)
+	assert.Equal(t, guid, parts[0].GUID)
+	assert.Equal(t, int64(1<<2), parts[0].Attributes)
+	assert.Empty(t, parts[0].MBRType)
+
+	ss, err := disk.SectorSize()
+	require.Nil(t, err)
+	assert.Equal(t, uint64(16384*ss-1), parts[1].End)
+
+	// MBR only attributes can't be set on GPT disks
+	assert.NotNil(t, disk.SetMBRID(1, 0x0c))
+
+	require.Nil(t, disk.DeletePartition(2))
+	parts, err = disk.Partitions()
+	require.Nil(t, err)
+	require.Len(t, parts, 1)
+	assert.Equal(t, 1, parts[0].Number)
+}
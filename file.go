@@ -58,7 +58,7 @@ func newFile(fs *Fs, name string, flag int, perm os.FileMode) (*file, error) {
 		return nil, wrapErr(err, name)
 	}
 
-	ret.stat = newFileInfo(name, s)
+	ret.stat = newFileInfo(fs, name, s)
 
 	if ret.stat.IsDir() && ret.writeAllowed() {
 		return nil, errors.New("is a directory")
@@ -88,16 +88,29 @@ func (f *file) readAllowed() bool {
 
 // Close implements afero.File.
 func (f *file) Close() error {
-	if f.modified {
-		if err := f.fs.guestfs.Write(f.name, f.buf); err != nil {
-			return wrapErr(err, f.name)
-		}
-		if !f.fileExists {
-			if err := f.fs.guestfs.Chmod(int(posixMode(f.perm)), f.name); err != nil {
-				return wrapErr(err, f.name)
-			}
+	return f.flush()
+}
+
+// flush writes the buffer to the guest if it was modified.
+func (f *file) flush() error {
+	if !f.modified {
+		return nil
+	}
+	if f.fileExists {
+		f.fs.ids.invalidate(f.name)
+	} else {
+		f.fs.invalidate(f.name)
+	}
+	if err := f.fs.guestfs.Write(f.name, f.buf); err != nil {
+		return wrapErr(err, f.name)
+	}
+	if !f.fileExists {
+		if err := f.fs.chmodMasked(f.name, f.perm); err != nil {
+			return err
 		}
 	}
+	f.modified = false
+	f.fileExists = true
 	return nil
 }
 
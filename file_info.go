@@ -3,6 +3,7 @@ package aferoguestfs
 import (
 	"io/fs"
 	"path/filepath"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -10,12 +11,14 @@ import (
 )
 
 type fileInfo struct {
+	fs   *Fs
 	name string
 	stat *guestfs.StatNS
 }
 
-func newFileInfo(name string, stat *guestfs.StatNS) *fileInfo {
+func newFileInfo(fs *Fs, name string, stat *guestfs.StatNS) *fileInfo {
 	return &fileInfo{
+		fs:   fs,
 		name: filepath.Base(name),
 		stat: stat,
 	}
@@ -89,6 +92,28 @@ func (f *fileInfo) Gid() int {
 	return int(f.stat.St_gid)
 }
 
+// Uname returns the name of the owner in the guest's /etc/passwd, or the
+// numeric ID if it has no name.
+func (f *fileInfo) Uname() string {
+	if f.fs != nil {
+		if u, err := f.fs.lookupUserID(f.Uid()); err == nil {
+			return u.Name
+		}
+	}
+	return strconv.Itoa(f.Uid())
+}
+
+// Gname returns the name of the group in the guest's /etc/group, or the
+// numeric ID if it has no name.
+func (f *fileInfo) Gname() string {
+	if f.fs != nil {
+		if g, err := f.fs.lookupGroupID(f.Gid()); err == nil {
+			return g.Name
+		}
+	}
+	return strconv.Itoa(f.Gid())
+}
+
 // Ino implements aferosync.FileInfoInoer.
 func (f *fileInfo) Ino() int {
 	return int(f.stat.St_ino)
@@ -5,6 +5,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -14,6 +17,20 @@ import (
 
 type Fs struct {
 	guestfs *guestfs.Guestfs
+
+	// localMount is the active MountLocal, if any
+	localMountMu sync.Mutex
+	localMount   *LocalMount
+
+	// ids caches the parsed /etc/passwd and /etc/group
+	ids idCache
+
+	// paths caches case-sensitive paths, see SetCaseInsensitive
+	paths caseCache
+
+	// mounts are the filesystems mounted by the opener, mounted again after
+	// Inspect. It is nil when the handle was mounted by the caller.
+	mounts []Mount
 }
 
 func New(g *guestfs.Guestfs) *Fs {
@@ -24,19 +41,19 @@ func New(g *guestfs.Guestfs) *Fs {
 
 // Chmod implements afero.Fs.
 func (fs *Fs) Chmod(name string, mode os.FileMode) error {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
 	return wrapErr(fs.guestfs.Chmod(int(posixMode(mode)), name), name)
 }
 
 // Chown implements afero.Fs.
 func (fs *Fs) Chown(name string, uid int, gid int) error {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
 	return wrapErr(fs.guestfs.Chown(uid, gid, name), name)
 }
 
 // Chtimes implements afero.Fs.
 func (fs *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
 	return wrapErr(fs.guestfs.Utimens(name, atime.Unix(), int64(atime.Nanosecond()), mtime.Unix(), int64(mtime.Nanosecond())), name)
 }
 
@@ -47,14 +64,96 @@ func (fs *Fs) Create(name string) (afero.File, error) {
 
 // Mkdir implements afero.Fs.
 func (fs *Fs) Mkdir(name string, perm os.FileMode) error {
-	name = normalizePath(name)
-	return wrapErr(fs.guestfs.Mkdir_mode(name, int(posixMode(perm))), name)
+	name = fs.resolvePath(name)
+	fs.invalidate(name)
+	return fs.mkdir(name, perm)
 }
 
-// MkdirAll implements afero.Fs.
+// MkdirAll implements afero.Fs. Like os.MkdirAll, every missing directory is
+// created with perm.
 func (fs *Fs) MkdirAll(path string, perm os.FileMode) error {
-	path = normalizePath(path)
-	return wrapErr(fs.guestfs.Mkdir_p(path), path)
+	path = fs.resolvePath(path)
+	fs.invalidate(path)
+
+	var missing []string
+	for p := path; ; p = filepath.Dir(p) {
+		isDir, err := fs.guestfs.Is_dir(p, &guestfs.OptargsIs_dir{
+			Followsymlinks_is_set: true,
+			Followsymlinks:        true,
+		})
+		if err != nil {
+			return wrapErr(err, p)
+		}
+		if isDir {
+			break
+		}
+
+		exists, err := fs.guestfs.Exists(p)
+		if err != nil {
+			return wrapErr(err, p)
+		}
+		if exists {
+			return &os.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+		}
+
+		missing = append(missing, p)
+		if p == "/" {
+			break
+		}
+	}
+
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := fs.mkdir(missing[i], perm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mkdir creates name with perm masked by the umask.
+func (fs *Fs) mkdir(name string, perm os.FileMode) error {
+	// the appliance applies the umask, see SetUmask
+	if err := fs.guestfs.Mkdir_mode(name, int(posixMode(perm))); err != nil {
+		return wrapErr(err, name)
+	}
+
+	// mkdir may ignore the setuid, setgid and sticky bits, so set them like
+	// os.Mkdir does
+	if perm&(os.ModeSetuid|os.ModeSetgid|os.ModeSticky) != 0 {
+		return fs.chmodMasked(name, perm)
+	}
+
+	return nil
+}
+
+// chmodMasked sets the mode of name to perm masked by the umask.
+func (fs *Fs) chmodMasked(name string, perm os.FileMode) error {
+	umask, err := fs.Umask()
+	if err != nil {
+		return err
+	}
+	return wrapErr(fs.guestfs.Chmod(int(posixMode(perm)&^uint32(umask)), name), name)
+}
+
+// Umask returns the umask applied to the permissions of files and directories
+// created through Fs. It is read from the appliance each time, so it also
+// reflects changes made directly on the guestfs handle. It defaults to 022.
+func (fs *Fs) Umask() (os.FileMode, error) {
+	mask, err := fs.guestfs.Get_umask()
+	if err != nil {
+		return 0, fmt.Errorf("get umask failed: %w", err)
+	}
+	return os.FileMode(mask).Perm(), nil
+}
+
+// SetUmask sets the umask of the appliance, applied to the permissions of
+// files and directories created through Fs and by the appliance itself.
+func (fs *Fs) SetUmask(mask os.FileMode) error {
+	if _, err := fs.guestfs.Umask(int(mask.Perm())); err != nil {
+		return fmt.Errorf("set umask failed: %w", err)
+	}
+	return nil
 }
 
 // Name implements afero.Fs.
@@ -69,33 +168,42 @@ func (fs *Fs) Open(name string) (afero.File, error) {
 
 // OpenFile implements afero.Fs.
 func (fs *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
 	f, err := newFile(fs, name, flag, perm)
 	return f, wrapErr(err, name)
 }
 
 // Remove implements afero.Fs.
 func (fs *Fs) Remove(name string) error {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
+	fs.invalidate(name)
 	return wrapErr(fs.guestfs.Rm(name), name)
 }
 
 // RemoveAll implements afero.Fs.
 func (fs *Fs) RemoveAll(path string) error {
-	path = normalizePath(path)
+	path = fs.resolvePath(path)
+	fs.invalidate(path)
 	return wrapErr(fs.guestfs.Rm_rf(path), path)
 }
 
 // Rename implements afero.Fs.
 func (fs *Fs) Rename(oldname string, newname string) error {
-	oldname = normalizePath(oldname)
-	newname = normalizePath(newname)
+	oldname = fs.resolvePath(oldname)
+	target := fs.resolvePath(newname)
+	if target == oldname {
+		// only the case changes, e.g. "foo" to "FOO", which resolves to
+		// oldname itself
+		target = fs.resolveParent(newname)
+	}
+	newname = target
+	fs.invalidate(oldname, newname)
 	return wrapErr(fs.guestfs.Rename(oldname, newname), oldname)
 }
 
 // Stat implements afero.Fs.
 func (fs *Fs) Stat(name string) (os.FileInfo, error) {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
 
 	// calling Exists before Statns prevents a "No such file or directory"
 	// error from being printed by libguestfs
@@ -108,12 +216,12 @@ func (fs *Fs) Stat(name string) (os.FileInfo, error) {
 		return nil, wrapErr(err, name)
 	}
 
-	return newFileInfo(name, s), nil
+	return newFileInfo(fs, name, s), nil
 }
 
 // Lstat is the analogue of os.Lstat.
 func (fs *Fs) Lstat(name string) (os.FileInfo, error) {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
 
 	// calling Exists before Lstatns prevents a "No such file or directory"
 	// error from being printed by libguestfs
@@ -126,7 +234,7 @@ func (fs *Fs) Lstat(name string) (os.FileInfo, error) {
 		return nil, wrapErr(err, name)
 	}
 
-	return newFileInfo(name, s), nil
+	return newFileInfo(fs, name, s), nil
 }
 
 // LstatIfPossible implements afero.Symlinker.
@@ -137,7 +245,7 @@ func (fs *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
 
 // Readlink is the analogue of os.Readlink.
 func (fs *Fs) Readlink(name string) (string, error) {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
 	target, err := fs.guestfs.Readlink(name)
 	return target, wrapErr(err, name)
 }
@@ -149,7 +257,8 @@ func (fs *Fs) ReadlinkIfPossible(name string) (string, error) {
 
 // Symlink is analogous to os.Symlink.
 func (fs *Fs) Symlink(oldname string, newname string) error {
-	newname = normalizePath(newname)
+	newname = fs.resolvePath(newname)
+	fs.invalidate(newname)
 	return wrapErr(fs.guestfs.Ln_s(oldname, newname), newname)
 }
 
@@ -160,20 +269,23 @@ func (fs *Fs) SymlinkIfPossible(oldname string, newname string) error {
 
 // Link is analogous to os.Link.
 func (fs *Fs) Link(oldname string, newname string) error {
-	oldname = normalizePath(oldname)
-	newname = normalizePath(newname)
+	oldname = fs.resolvePath(oldname)
+	newname = fs.resolvePath(newname)
+	fs.invalidate(newname)
 	return wrapErr(fs.guestfs.Ln(oldname, newname), newname)
 }
 
 // Lchown implements aferosync.Lchowner.
 func (fs *Fs) Lchown(name string, uid, gid int) error {
-	name = normalizePath(name)
+	name = fs.resolvePath(name)
 	return wrapErr(fs.guestfs.Lchown(uid, gid, name), name)
 }
 
 // TarOut implements aferosync.TarOuter.
+//
+// The archive includes the contents of filesystems mounted below dir.
 func (fs *Fs) TarOut(dir string, w io.Writer) error {
-	dir = normalizePath(dir)
+	dir = fs.resolvePath(dir)
 
 	f, err := os.CreateTemp("", "afero-guestfs-tarout-*.tar")
 	if err != nil {
@@ -190,6 +302,7 @@ func (fs *Fs) TarOut(dir string, w io.Writer) error {
 	if err != nil {
 		return fmt.Errorf("failed to open tar: %w", err)
 	}
+	defer f.Close()
 
 	if _, err := io.Copy(w, f); err != nil {
 		return fmt.Errorf("failed to copy: %w", err)
@@ -198,38 +311,84 @@ func (fs *Fs) TarOut(dir string, w io.Writer) error {
 	return nil
 }
 
+// TarIn extracts the tar archive read from r into dir.
+func (fs *Fs) TarIn(r io.Reader, dir string) error {
+	dir = fs.resolvePath(dir)
+
+	f, err := os.CreateTemp("", "afero-guestfs-tarin-*.tar")
+	if err != nil {
+		return fmt.Errorf("failed to create tmp tar: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, r)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to copy: %w", err)
+	}
+
+	fs.invalidateAll()
+	if err := fs.guestfs.Tar_in(f.Name(), dir, nil); err != nil {
+		return fmt.Errorf("failed to extract tar: %w", wrapErr(err, dir))
+	}
+
+	return nil
+}
+
 // AllPaths implements aferosync.AllPathser.
+//
+// Every mounted filesystem is walked and its paths are prefixed with its
+// mountpoint. Paths hidden by a filesystem mounted on top of them are left
+// out.
 func (fs *Fs) AllPaths() ([]string, error) {
 	mps, err := fs.guestfs.Mountpoints()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get mountpoints: %w", err)
 	}
 
-	var device string
+	mountpoints := make([]string, 0, len(mps))
+	devices := map[string]string{}
 	for d, path := range mps {
-		if path == "/" {
-			device = d
-			break
-		}
+		mountpoints = append(mountpoints, path)
+		devices[path] = d
 	}
-	if device == "" {
+	if _, ok := devices["/"]; !ok {
 		return nil, fmt.Errorf("nothing mounted at root")
 	}
 
-	ents, err := fs.guestfs.Filesystem_walk(device)
-	if err != nil {
-		return nil, fmt.Errorf("failed to walk device %s: %w", device, err)
-	}
+	sort.Slice(mountpoints, func(i, j int) bool {
+		return mountpoints[i] < mountpoints[j]
+	})
+
+	var paths []string
+	for _, mp := range mountpoints {
+		device := devices[mp]
 
-	paths := make([]string, 0, len(*ents))
+		ents, err := fs.guestfs.Filesystem_walk(device)
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk device %s: %w", device, err)
+		}
 
-	for _, e := range *ents {
-		paths = append(paths, e.Tsk_name)
+		prefix := strings.TrimPrefix(mp, "/")
+		for _, e := range *ents {
+			p := filepath.Join(prefix, e.Tsk_name)
+			if isShadowed(p, mp, mountpoints) {
+				continue
+			}
+			paths = append(paths, p)
+		}
 	}
 
 	return paths, nil
 }
 
+// Statfs returns filesystem statistics of the filesystem containing name.
+func (fs *Fs) Statfs(name string) (*guestfs.StatVFS, error) {
+	name = fs.resolvePath(name)
+	s, err := fs.guestfs.Statvfs(name)
+	return s, wrapErr(err, name)
+}
+
 func (fs *Fs) exists(name string) error {
 	exists, err := fs.guestfs.Exists(name)
 	if err != nil {
@@ -58,6 +58,41 @@ func newGuestFs(diskPath, partDev string) (g *guestfs.Guestfs, close func() erro
 	}, nil
 }
 
+// newTest1Image copies test1.img to a temp file and returns its path.
+func newTest1Image(t *testing.T) string {
+	f, err := os.CreateTemp("", "afero-guestfs-test-*.img")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	_, err = io.Copy(f, bytes.NewBuffer(test1Img))
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	return f.Name()
+}
+
+// newImage creates a sparse raw image of size bytes in a temp file and calls
+// init with a launched guestfs handle to partition and format it.
+func newImage(t *testing.T, size int64, init func(g *guestfs.Guestfs) error) string {
+	f, err := os.CreateTemp("", "afero-guestfs-test-*.img")
+	require.Nil(t, err)
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	require.Nil(t, f.Truncate(size))
+	require.Nil(t, f.Close())
+
+	g, err := guestfs.Create()
+	require.Nil(t, err)
+	defer g.Close()
+
+	require.Nil(t, g.Add_drive(f.Name(), nil))
+	require.Nil(t, g.Launch())
+	require.Nil(t, init(g))
+	require.Nil(t, g.Shutdown())
+
+	return f.Name()
+}
+
 func setup() (*aferoguestfs.Fs, func(), error) {
 	f, err := os.CreateTemp("", "afero-guestfs-test*.img")
 	if err != nil {
@@ -232,6 +267,81 @@ func TestMkdirAll(t *testing.T) {
 	assert.True(t, exists)
 }
 
+func TestMkdirAllPerm(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.Mkdir("home", 0755))
+	require.Nil(t, gfs.MkdirAll("home/user/.ssh", 0700))
+
+	for _, name := range []string{"home/user", "home/user/.ssh"} {
+		stat, err := gfs.Stat(name)
+		require.Nil(t, err)
+		assert.Equal(t, os.ModeDir|0700, stat.Mode(), name)
+	}
+
+	stat, err := gfs.Stat("home")
+	require.Nil(t, err)
+	assert.Equal(t, os.ModeDir|0755, stat.Mode())
+
+	require.Nil(t, afero.WriteFile(gfs, "home/file", nil, 0644))
+	assert.NotNil(t, gfs.MkdirAll("home/file/dir", 0755))
+}
+
+func TestUmask(t *testing.T) {
+	clear(t, gfs)
+
+	umask, err := gfs.Umask()
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(022), umask)
+
+	require.Nil(t, gfs.SetUmask(077))
+	defer gfs.SetUmask(umask)
+
+	f, err := gfs.Create("test.txt")
+	require.Nil(t, err)
+	require.Nil(t, f.Close())
+
+	require.Nil(t, gfs.Mkdir("dir", 0777))
+	require.Nil(t, gfs.MkdirAll("a/b", 0777))
+
+	for name, mode := range map[string]os.FileMode{
+		"test.txt": 0600,
+		"dir":      os.ModeDir | 0700,
+		"a":        os.ModeDir | 0700,
+		"a/b":      os.ModeDir | 0700,
+	} {
+		stat, err := gfs.Stat(name)
+		require.Nil(t, err)
+		assert.Equal(t, mode, stat.Mode(), name)
+	}
+}
+
+func TestUmaskSetOnHandle(t *testing.T) {
+	image := newTest1Image(t)
+
+	g, err := guestfs.Create()
+	require.Nil(t, err)
+	defer g.Close()
+
+	require.Nil(t, g.Add_drive(image, nil))
+	require.Nil(t, g.Launch())
+	require.Nil(t, g.Mount("/dev/sda2", "/"))
+
+	fsys := aferoguestfs.New(g)
+
+	_, err = g.Umask(077)
+	require.Nil(t, err)
+
+	umask, err := fsys.Umask()
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(077), umask)
+
+	require.Nil(t, fsys.Mkdir("dir", 0777))
+	fi, err := fsys.Stat("dir")
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+}
+
 func TestRemove(t *testing.T) {
 	clear(t, gfs)
 
@@ -324,7 +434,10 @@ func TestOpenFile(t *testing.T) {
 
 		fi, err := gfs.Lstat("test1.txt")
 		require.Nil(t, err)
-		assert.Equal(t, fi.Mode().Perm(), fs.ModePerm)
+
+		umask, err := gfs.Umask()
+		require.Nil(t, err)
+		assert.Equal(t, fi.Mode().Perm(), fs.ModePerm&^umask)
 	})
 }
 
@@ -489,7 +602,7 @@ func TestTarOut(t *testing.T) {
 			Typeflag: tar.TypeReg,
 			Name:     "./test.txt",
 			Size:     9,
-			Mode:     int64(fs.ModePerm),
+			Mode:     0755,
 			Uname:    "root",
 			Gname:    "root",
 			Format:   tar.FormatGNU,
@@ -498,6 +611,28 @@ func TestTarOut(t *testing.T) {
 	}}, actual)
 }
 
+func TestTarIn(t *testing.T) {
+	clear(t, gfs)
+
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	require.Nil(t, tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     "test.txt",
+		Size:     9,
+		Mode:     0644,
+	}))
+	_, err := tw.Write([]byte("some text"))
+	require.Nil(t, err)
+	require.Nil(t, tw.Close())
+
+	require.Nil(t, gfs.TarIn(buf, "."))
+
+	body, err := afero.ReadFile(gfs, "test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(body))
+}
+
 func TestAllPaths(t *testing.T) {
 	clear(t, gfs)
 
@@ -7,6 +7,7 @@ toolchain go1.24.7
 require (
 	github.com/spf13/afero v1.15.0
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/net v0.43.0
 )
 
 require (
@@ -0,0 +1,156 @@
+package aferoguestfs
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+)
+
+// preadChunkSize is the most read from the appliance by one pread call. It is
+// well below the limit of the libguestfs protocol.
+const preadChunkSize = 1 << 20
+
+// HTTPHandler serves the files of an Fs read-only, with directory listings and
+// range requests.
+type HTTPHandler struct {
+	fs *Fs
+}
+
+// NewHTTPHandler returns an HTTPHandler serving fs. Only GET and HEAD requests
+// are allowed, so the guest is never modified.
+func NewHTTPHandler(fs *Fs) *HTTPHandler {
+	return &HTTPHandler{fs: fs}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reqName := path.Clean("/" + r.URL.Path)
+
+	// resolve once, so that the case-insensitive lookup isn't repeated for
+	// every read
+	name := h.fs.resolvePath(reqName)
+
+	info, err := h.fs.Stat(name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		if name != "/" && r.URL.Path[len(r.URL.Path)-1] != '/' {
+			http.Redirect(w, r, path.Base(reqName)+"/", http.StatusMovedPermanently)
+			return
+		}
+		h.serveDir(w, r, name)
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+
+	fi := info.(*fileInfo)
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.Ino(), fi.ModTime().UnixNano()))
+
+	http.ServeContent(w, r, name, fi.ModTime(), &preadReader{fs: h.fs, name: name, size: fi.Size()})
+}
+
+// serveDir writes an HTML listing of dir.
+func (h *HTTPHandler) serveDir(w http.ResponseWriter, r *http.Request, dir string) {
+	entries, err := h.fs.readDirBatch(dir, false)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].info.name < entries[j].info.name
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	fmt.Fprintf(w, "<!doctype html>\n<title>%s</title>\n<pre>\n", html.EscapeString(dir))
+	for _, e := range entries {
+		name := e.info.name
+		if e.info.IsDir() {
+			name += "/"
+		}
+		u := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", u.String(), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+}
+
+// httpError writes the HTTP status matching err.
+func httpError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, os.ErrPermission):
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+	}
+}
+
+// preadReader is an io.ReadSeeker reading a guest file with pread, so only
+// the requested ranges are transferred from the appliance.
+type preadReader struct {
+	fs   *Fs
+	name string
+	size int64
+	pos  int64
+}
+
+func (r *preadReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	count := min(len(p), preadChunkSize)
+	bs, err := r.fs.guestfs.Pread(r.name, count, r.pos)
+	if err != nil {
+		return 0, wrapErr(err, r.name)
+	}
+	if len(bs) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, bs)
+	r.pos += int64(n)
+	return n, nil
+}
+
+func (r *preadReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, os.ErrInvalid
+	}
+	if pos < 0 {
+		return 0, os.ErrInvalid
+	}
+	r.pos = pos
+	return pos, nil
+}
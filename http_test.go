@@ -0,0 +1,95 @@
+package aferoguestfs_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.Mkdir("/dir", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "/dir/test.txt", []byte("some text"), 0644))
+
+	srv := httptest.NewServer(aferoguestfs.NewHTTPHandler(gfs))
+	defer srv.Close()
+
+	get := func(path string, header http.Header) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.Nil(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return resp, string(body)
+	}
+
+	resp, body := get("/dir/test.txt", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "some text", body)
+	assert.Equal(t, "9", resp.Header.Get("Content-Length"))
+	assert.NotEmpty(t, resp.Header.Get("Last-Modified"))
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	resp, body = get("/dir/test.txt", http.Header{"Range": {"bytes=5-"}})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "text", body)
+
+	resp, _ = get("/dir/test.txt", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, body = get("/dir/", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `<a href="test.txt">test.txt</a>`)
+
+	resp, _ = get("/missing", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/dir/test.txt", nil)
+	require.Nil(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestHTTPHandlerCaseInsensitive(t *testing.T) {
+	clear(t, gfs)
+	defer gfs.SetCaseInsensitive(false)
+
+	require.Nil(t, gfs.Mkdir("/Dir", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "/Dir/Test.txt", []byte("some text"), 0644))
+
+	gfs.SetCaseInsensitive(true)
+
+	srv := httptest.NewServer(aferoguestfs.NewHTTPHandler(gfs))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/dir/test.TXT")
+	require.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "some text", string(body))
+
+	resp, err = http.Get(srv.URL + "/DIR/")
+	require.Nil(t, err)
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `<a href="Test.txt">Test.txt</a>`)
+}
@@ -0,0 +1,248 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// stRdonly is the statvfs flag of filesystems mounted read-only.
+const stRdonly = 1
+
+// OS describes an operating system found by inspection.
+type OS struct {
+	// Root is the root device of the operating system. It identifies the
+	// operating system in other inspection calls.
+	Root string
+
+	// Type is e.g. "linux" or "windows".
+	Type string
+	// Distro is e.g. "fedora", "debian" or "windows".
+	Distro         string
+	ProductName    string
+	ProductVariant string
+	MajorVersion   int
+	MinorVersion   int
+	Arch           string
+	Hostname       string
+	OSInfo         string
+
+	// PackageFormat is e.g. "rpm" or "deb".
+	PackageFormat string
+	// PackageManagement is e.g. "dnf" or "apt".
+	PackageManagement string
+
+	// Filesystems are all filesystems belonging to the operating system.
+	Filesystems []string
+	// Mountpoints maps mountpoints to filesystems.
+	Mountpoints map[string]string
+}
+
+// MountTable returns the mount table of the operating system, read-only if
+// readOnly is set.
+func (o *OS) MountTable(readOnly bool) []Mount {
+	ret := make([]Mount, 0, len(o.Mountpoints))
+	for mp, device := range o.Mountpoints {
+		ret = append(ret, Mount{
+			Device:     device,
+			Mountpoint: mp,
+			ReadOnly:   readOnly,
+		})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Mountpoint < ret[j].Mountpoint
+	})
+
+	return ret
+}
+
+// Inspect inspects the disk images for operating systems.
+//
+// Inspection unmounts all filesystems. Filesystems mounted before the call
+// are mounted again with the options they were opened with. If the handle
+// was mounted by the caller, they are mounted again at the same mountpoints,
+// read-only if they were, but other options are lost.
+func (fs *Fs) Inspect() ([]OS, error) {
+	mounts := fs.mounts
+	if mounts == nil {
+		var err error
+		if mounts, err = fs.currentMounts(); err != nil {
+			return nil, err
+		}
+	}
+
+	roots, inspectErr := fs.guestfs.Inspect_os()
+
+	if err := MountAll(fs.guestfs, mounts); err != nil {
+		return nil, fmt.Errorf("failed to remount filesystems: %w", err)
+	}
+
+	if inspectErr != nil {
+		return nil, fmt.Errorf("inspection failed: %w", inspectErr)
+	}
+
+	ret := make([]OS, 0, len(roots))
+	for _, root := range roots {
+		o, err := inspectRoot(fs.guestfs, root)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *o)
+	}
+
+	return ret, nil
+}
+
+// currentMounts returns the mount table of the handle.
+func (fs *Fs) currentMounts() ([]Mount, error) {
+	mps, err := fs.guestfs.Mountpoints()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mountpoints: %w", err)
+	}
+
+	mounts := make([]Mount, 0, len(mps))
+	for device, mp := range mps {
+		st, err := fs.guestfs.Statvfs(mp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat filesystem at %s: %w", mp, err)
+		}
+
+		mounts = append(mounts, Mount{
+			Device:     device,
+			Mountpoint: mp,
+			ReadOnly:   st.Flag&stRdonly != 0,
+		})
+	}
+
+	return mounts, nil
+}
+
+// OpenInspectedFs opens a disk image containing a single operating system and
+// mounts its filesystems as inspection found them in the guest's fstab. If
+// readOnly is set, the image is also added read-only, so it isn't modified at
+// all.
+func OpenInspectedFs(image string, readOnly bool) (*PartitionFs, *OS, error) {
+	g, err := launch(image, false, readOnly)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roots, err := g.Inspect_os()
+	if err != nil {
+		g.Close()
+		return nil, nil, fmt.Errorf("inspection failed: %w", err)
+	}
+
+	if len(roots) != 1 {
+		g.Close()
+		return nil, nil, fmt.Errorf("expected one operating system, found %d", len(roots))
+	}
+
+	o, err := inspectRoot(g, roots[0])
+	if err != nil {
+		g.Close()
+		return nil, nil, err
+	}
+
+	mounts := o.MountTable(readOnly)
+	if err := MountAll(g, mounts); err != nil {
+		g.Umount_all()
+		g.Close()
+		return nil, nil, err
+	}
+
+	p := &PartitionFs{Fs: New(g), LVM: NewLVM(g), LUKS: NewLUKS(g), inner: g}
+	p.mounts = mounts
+	return p, o, nil
+}
+
+func inspectRoot(g *guestfs.Guestfs, root string) (*OS, error) {
+	o := &OS{Root: root}
+
+	var err error
+	strs := []struct {
+		name string
+		dst  *string
+		get  func(string) (string, error)
+	}{
+		{"type", &o.Type, g.Inspect_get_type},
+		{"distro", &o.Distro, g.Inspect_get_distro},
+		{"product name", &o.ProductName, g.Inspect_get_product_name},
+		{"product variant", &o.ProductVariant, g.Inspect_get_product_variant},
+		{"arch", &o.Arch, g.Inspect_get_arch},
+		{"hostname", &o.Hostname, g.Inspect_get_hostname},
+		{"osinfo", &o.OSInfo, g.Inspect_get_osinfo},
+		{"package format", &o.PackageFormat, g.Inspect_get_package_format},
+		{"package management", &o.PackageManagement, g.Inspect_get_package_management},
+	}
+	for _, s := range strs {
+		if *s.dst, err = s.get(root); err != nil {
+			return nil, fmt.Errorf("failed to get %s of %s: %w", s.name, root, err)
+		}
+	}
+
+	if o.MajorVersion, err = g.Inspect_get_major_version(root); err != nil {
+		return nil, fmt.Errorf("failed to get major version of %s: %w", root, err)
+	}
+	if o.MinorVersion, err = g.Inspect_get_minor_version(root); err != nil {
+		return nil, fmt.Errorf("failed to get minor version of %s: %w", root, err)
+	}
+	if o.Filesystems, err = g.Inspect_get_filesystems(root); err != nil {
+		return nil, fmt.Errorf("failed to get filesystems of %s: %w", root, err)
+	}
+	if o.Mountpoints, err = g.Inspect_get_mountpoints(root); err != nil {
+		return nil, fmt.Errorf("failed to get mountpoints of %s: %w", root, err)
+	}
+
+	return o, nil
+}
+
+// Application is an application or package installed in a guest.
+type Application struct {
+	Name          string
+	DisplayName   string
+	Epoch         int
+	Version       string
+	Release       string
+	Arch          string
+	InstallPath   string
+	Publisher     string
+	URL           string
+	SourcePackage string
+	Summary       string
+	Description   string
+}
+
+// ListApplications lists the applications installed in the operating system
+// identified by root.
+//
+// Inspection must have been done on the handle, and the operating system's
+// filesystems must be mounted, e.g. by opening it with OpenInspectedFs.
+func (fs *Fs) ListApplications(root string) ([]Application, error) {
+	apps, err := fs.guestfs.Inspect_list_applications2(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applications of %s: %w", root, err)
+	}
+
+	ret := make([]Application, 0, len(*apps))
+	for _, a := range *apps {
+		ret = append(ret, Application{
+			Name:          a.App2_name,
+			DisplayName:   a.App2_display_name,
+			Epoch:         int(a.App2_epoch),
+			Version:       a.App2_version,
+			Release:       a.App2_release,
+			Arch:          a.App2_arch,
+			InstallPath:   a.App2_install_path,
+			Publisher:     a.App2_publisher,
+			URL:           a.App2_url,
+			SourcePackage: a.App2_source_package,
+			Summary:       a.App2_summary,
+			Description:   a.App2_description,
+		})
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,164 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDebianImage creates an image with a minimal Debian root filesystem on
+// /dev/sda1, enough for inspection to recognize it.
+func newDebianImage(t *testing.T) string {
+	files := map[string]string{
+		"/etc/fstab":          "/dev/sda1 / ext4 defaults 0 1\n",
+		"/etc/os-release":     "ID=debian\nVERSION_ID=\"12\"\nPRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\n",
+		"/etc/debian_version": "12.0\n",
+		"/etc/hostname":       "testhost\n",
+		"/var/lib/dpkg/status": "Package: hello\nStatus: install ok installed\nArchitecture: amd64\n" +
+			"Version: 2.10-3\nDescription: example package based on GNU hello\n",
+	}
+
+	return newImage(t, 64*1024*1024, func(g *guestfs.Guestfs) error {
+		if err := g.Part_disk("/dev/sda", "mbr"); err != nil {
+			return err
+		}
+		if err := g.Mkfs("ext4", "/dev/sda1", nil); err != nil {
+			return err
+		}
+		if err := g.Mount("/dev/sda1", "/"); err != nil {
+			return err
+		}
+		for _, dir := range []string{"/bin", "/etc", "/usr/bin", "/var/lib/dpkg"} {
+			if err := g.Mkdir_p(dir); err != nil {
+				return err
+			}
+		}
+		for name, content := range files {
+			if err := g.Write(name, []byte(content)); err != nil {
+				return err
+			}
+		}
+		return g.Umount_all()
+	})
+}
+
+func TestInspect(t *testing.T) {
+	image := newDebianImage(t)
+
+	fsys, err := aferoguestfs.OpenPartitionFs(image, "/dev/sda1")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	oses, err := fsys.Inspect()
+	require.Nil(t, err)
+	require.Len(t, oses, 1)
+
+	assert.Equal(t, "/dev/sda1", oses[0].Root)
+	assert.Equal(t, "linux", oses[0].Type)
+	assert.Equal(t, "debian", oses[0].Distro)
+	assert.Equal(t, 12, oses[0].MajorVersion)
+	assert.Equal(t, "testhost", oses[0].Hostname)
+	assert.Equal(t, map[string]string{"/": "/dev/sda1"}, oses[0].Mountpoints)
+}
+
+func TestInspectKeepsReadOnly(t *testing.T) {
+	image := newDebianImage(t)
+
+	fsys, _, err := aferoguestfs.OpenInspectedFs(image, true)
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	_, err = fsys.Inspect()
+	require.Nil(t, err)
+
+	err = afero.WriteFile(fsys, "test.txt", []byte("some text"), os.ModePerm)
+	assert.NotNil(t, err)
+}
+
+func TestInspectKeepsSubvolume(t *testing.T) {
+	image := newBtrfsImage(t)
+
+	fsys, err := aferoguestfs.OpenBtrfsSubvolumeFs(image, "/dev/sda1", "root")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	_, err = fsys.Inspect()
+	require.Nil(t, err)
+
+	body, err := afero.ReadFile(fsys, "test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "in subvolume", string(body))
+}
+
+func TestInspectNoOS(t *testing.T) {
+	image := newTest1Image(t)
+
+	fsys, err := aferoguestfs.OpenPartitionFs(image, "/dev/sda2")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	require.Nil(t, afero.WriteFile(fsys, "test.txt", []byte("some text"), os.ModePerm))
+
+	oses, err := fsys.Inspect()
+	assert.Nil(t, err)
+	assert.Empty(t, oses)
+
+	// filesystems are mounted again after inspection
+	body, err := afero.ReadFile(fsys, "test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(body))
+}
+
+func TestOpenInspectedFsNoOS(t *testing.T) {
+	image := newTest1Image(t)
+
+	_, _, err := aferoguestfs.OpenInspectedFs(image, true)
+	assert.NotNil(t, err)
+}
+
+func TestOSMountTable(t *testing.T) {
+	o := aferoguestfs.OS{
+		Mountpoints: map[string]string{
+			"/boot": "/dev/sda1",
+			"/":     "/dev/sda2",
+		},
+	}
+
+	assert.Equal(t, []aferoguestfs.Mount{
+		{Device: "/dev/sda2", Mountpoint: "/", ReadOnly: true},
+		{Device: "/dev/sda1", Mountpoint: "/boot", ReadOnly: true},
+	}, o.MountTable(true))
+}
+
+func TestListApplications(t *testing.T) {
+	image := newDebianImage(t)
+
+	fsys, o, err := aferoguestfs.OpenInspectedFs(image, true)
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	apps, err := fsys.ListApplications(o.Root)
+	require.Nil(t, err)
+	require.Len(t, apps, 1)
+
+	assert.Equal(t, "hello", apps[0].Name)
+	assert.Equal(t, "2.10", apps[0].Version)
+	assert.Equal(t, "3", apps[0].Release)
+	assert.Equal(t, "amd64", apps[0].Arch)
+}
+
+func TestListApplicationsUnknownRoot(t *testing.T) {
+	image := newTest1Image(t)
+
+	fsys, err := aferoguestfs.OpenPartitionFs(image, "/dev/sda2")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	_, err = fsys.ListApplications("/dev/sda2")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,202 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultJournalDir is the directory of the persistent systemd journal.
+const DefaultJournalDir = "/var/log/journal"
+
+// JournalEntry is an entry of the systemd journal.
+type JournalEntry struct {
+	// Time is the realtime timestamp of the entry.
+	Time time.Time
+
+	// Fields maps field names, e.g. "MESSAGE" or "_SYSTEMD_UNIT", to their
+	// values.
+	Fields map[string][]byte
+}
+
+// Message returns the MESSAGE field of the entry.
+func (e *JournalEntry) Message() string {
+	return string(e.Fields["MESSAGE"])
+}
+
+// JournalFilter selects journal entries. Zero fields match everything.
+type JournalFilter struct {
+	// Since excludes entries before it.
+	Since time.Time
+	// Until excludes entries after it.
+	Until time.Time
+	// Unit only includes entries of a systemd unit, like journalctl -u. The
+	// ".service" suffix is added if the unit has no suffix.
+	Unit string
+}
+
+// Journal reads the systemd journal of the guest.
+//
+// Only one journal can be open per guestfs handle at a time. Iterate through
+// the entries like a bufio.Scanner:
+//
+//	j, err := fs.OpenJournal(aferoguestfs.DefaultJournalDir, filter)
+//	...
+//	defer j.Close()
+//	for j.Next() {
+//		fmt.Println(j.Entry().Message())
+//	}
+//	if err := j.Err(); err != nil {
+//		...
+//	}
+type Journal struct {
+	fs     *Fs
+	filter JournalFilter
+	unit   string
+
+	entry *JournalEntry
+	err   error
+
+	// done is set once an entry after filter.Until was read. Entries are
+	// ordered by time, so none of the following entries match.
+	done bool
+}
+
+// OpenJournal opens the journal files in dir.
+func (fs *Fs) OpenJournal(dir string, filter JournalFilter) (*Journal, error) {
+	dir = fs.resolvePath(dir)
+
+	if err := fs.guestfs.Journal_open(dir); err != nil {
+		return nil, wrapErr(err, dir)
+	}
+
+	unit := filter.Unit
+	if unit != "" && !strings.Contains(unit, ".") {
+		unit += ".service"
+	}
+
+	return &Journal{
+		fs:     fs,
+		filter: filter,
+		unit:   unit,
+	}, nil
+}
+
+// Close closes the journal.
+func (j *Journal) Close() error {
+	if err := j.fs.guestfs.Journal_close(); err != nil {
+		return fmt.Errorf("journal close failed: %w", err)
+	}
+	return nil
+}
+
+// Next advances to the next entry matching the filter. It returns false at
+// the end of the journal or on error.
+func (j *Journal) Next() bool {
+	j.entry = nil
+	if j.err != nil || j.done {
+		return false
+	}
+
+	for {
+		more, err := j.fs.guestfs.Journal_next()
+		if err != nil {
+			j.err = fmt.Errorf("journal next failed: %w", err)
+			return false
+		}
+		if !more {
+			return false
+		}
+
+		entry, err := j.read()
+		if err != nil {
+			j.err = err
+			return false
+		}
+
+		if entry != nil {
+			j.entry = entry
+			return true
+		}
+		if j.done {
+			return false
+		}
+	}
+}
+
+// Skip moves n entries forwards, or backwards if n is negative, ignoring the
+// filter. It returns the number of entries skipped. The entry skipped to is
+// returned by Entry if it matches the filter.
+func (j *Journal) Skip(n int64) (int64, error) {
+	skipped, err := j.fs.guestfs.Journal_skip(n)
+	if err != nil {
+		return 0, fmt.Errorf("journal skip failed: %w", err)
+	}
+
+	j.entry = nil
+	j.done = false
+	if skipped != 0 {
+		if j.entry, err = j.read(); err != nil {
+			return skipped, err
+		}
+	}
+
+	return skipped, nil
+}
+
+// Entry returns the current entry.
+func (j *Journal) Entry() *JournalEntry {
+	return j.entry
+}
+
+// Err returns the error that stopped Next.
+func (j *Journal) Err() error {
+	return j.err
+}
+
+// read reads the entry at the current position. It returns nil if the entry
+// doesn't match the filter, and sets done if it is after filter.Until.
+func (j *Journal) read() (*JournalEntry, error) {
+	usec, err := j.fs.guestfs.Journal_get_realtime_usec()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get journal entry time: %w", err)
+	}
+
+	t := time.UnixMicro(usec)
+	if !j.filter.Since.IsZero() && t.Before(j.filter.Since) {
+		return nil, nil
+	}
+	if !j.filter.Until.IsZero() && t.After(j.filter.Until) {
+		j.done = true
+		return nil, nil
+	}
+
+	fields, err := j.fs.guestfs.Journal_get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get journal entry: %w", err)
+	}
+
+	entry := &JournalEntry{
+		Time:   t,
+		Fields: make(map[string][]byte, len(*fields)),
+	}
+	for _, f := range *fields {
+		entry.Fields[f.Attrname] = f.Attrval
+	}
+
+	if j.unit != "" && !entry.hasUnit(j.unit) {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+// hasUnit reports whether the entry was logged by or about unit.
+func (e *JournalEntry) hasUnit(unit string) bool {
+	for _, field := range []string{"_SYSTEMD_UNIT", "UNIT", "OBJECT_SYSTEMD_UNIT", "COREDUMP_UNIT"} {
+		if string(e.Fields[field]) == unit {
+			return true
+		}
+	}
+	return false
+}
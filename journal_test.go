@@ -0,0 +1,180 @@
+package aferoguestfs_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/system.journal.gz
+var testJournalGz []byte
+
+// testJournalMessages are the messages logged by testdata/system.journal.gz
+// with SYSLOG_IDENTIFIER=afero-guestfs-test, in order.
+var testJournalMessages = []string{"first message", "second message", "third message"}
+
+// newJournalFs opens a scratch image with the test journal in
+// DefaultJournalDir. The journal doesn't fit the shared test image next to
+// the files of other tests.
+func newJournalFs(t *testing.T) *aferoguestfs.PartitionFs {
+	image := newImage(t, 16*1024*1024, func(g *guestfs.Guestfs) error {
+		if err := g.Part_disk("/dev/sda", "mbr"); err != nil {
+			return err
+		}
+		return g.Mkfs("ext4", "/dev/sda1", nil)
+	})
+
+	fsys, err := aferoguestfs.OpenPartitionFs(image, "/dev/sda1")
+	require.Nil(t, err)
+	t.Cleanup(func() { fsys.Close() })
+
+	zr, err := gzip.NewReader(bytes.NewReader(testJournalGz))
+	require.Nil(t, err)
+	data, err := io.ReadAll(zr)
+	require.Nil(t, err)
+
+	dir := filepath.Join(aferoguestfs.DefaultJournalDir, "fed6b2924c424cf1b9a322f606b4de6d")
+	require.Nil(t, fsys.MkdirAll(dir, 0755))
+	require.Nil(t, afero.WriteFile(fsys, filepath.Join(dir, "system.journal"), data, 0640))
+
+	return fsys
+}
+
+// readJournal returns all entries matching filter.
+func readJournal(t *testing.T, fsys *aferoguestfs.PartitionFs, filter aferoguestfs.JournalFilter) []*aferoguestfs.JournalEntry {
+	j, err := fsys.OpenJournal(aferoguestfs.DefaultJournalDir, filter)
+	require.Nil(t, err)
+	defer j.Close()
+
+	var entries []*aferoguestfs.JournalEntry
+	for j.Next() {
+		entries = append(entries, j.Entry())
+	}
+	require.Nil(t, j.Err())
+
+	return entries
+}
+
+// testMessages returns the messages of the entries logged by the test.
+func testMessages(entries []*aferoguestfs.JournalEntry) []string {
+	var ret []string
+	for _, e := range entries {
+		if string(e.Fields["SYSLOG_IDENTIFIER"]) == "afero-guestfs-test" {
+			ret = append(ret, e.Message())
+		}
+	}
+	return ret
+}
+
+func TestOpenJournalNotExist(t *testing.T) {
+	clear(t, gfs)
+
+	_, err := gfs.OpenJournal(aferoguestfs.DefaultJournalDir, aferoguestfs.JournalFilter{})
+	assert.NotNil(t, err)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalNext(t *testing.T) {
+	fsys := newJournalFs(t)
+
+	entries := readJournal(t, fsys, aferoguestfs.JournalFilter{})
+	assert.Len(t, entries, 8)
+	assert.Equal(t, testJournalMessages, testMessages(entries))
+
+	for i := 1; i < len(entries); i++ {
+		assert.False(t, entries[i].Time.Before(entries[i-1].Time))
+	}
+}
+
+func TestJournalUnit(t *testing.T) {
+	fsys := newJournalFs(t)
+
+	entries := readJournal(t, fsys, aferoguestfs.JournalFilter{Unit: "sshd"})
+	assert.Equal(t, []string{"first message", "third message"}, testMessages(entries))
+	assert.Len(t, entries, 2)
+}
+
+func TestJournalSinceUntil(t *testing.T) {
+	fsys := newJournalFs(t)
+
+	var test []*aferoguestfs.JournalEntry
+	for _, e := range readJournal(t, fsys, aferoguestfs.JournalFilter{}) {
+		if len(testMessages([]*aferoguestfs.JournalEntry{e})) > 0 {
+			test = append(test, e)
+		}
+	}
+	require.Len(t, test, 3)
+
+	entries := readJournal(t, fsys, aferoguestfs.JournalFilter{Since: test[1].Time, Until: test[1].Time})
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second message", entries[0].Message())
+
+	entries = readJournal(t, fsys, aferoguestfs.JournalFilter{Until: test[0].Time})
+	require.NotEmpty(t, entries)
+	assert.Equal(t, "first message", entries[len(entries)-1].Message())
+
+	entries = readJournal(t, fsys, aferoguestfs.JournalFilter{Since: test[2].Time})
+	require.NotEmpty(t, entries)
+	assert.Equal(t, "third message", entries[0].Message())
+}
+
+func TestJournalSkip(t *testing.T) {
+	fsys := newJournalFs(t)
+
+	all := readJournal(t, fsys, aferoguestfs.JournalFilter{})
+	require.Len(t, all, 8)
+
+	j, err := fsys.OpenJournal(aferoguestfs.DefaultJournalDir, aferoguestfs.JournalFilter{})
+	require.Nil(t, err)
+	defer j.Close()
+
+	skipped, err := j.Skip(3)
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), skipped)
+	require.NotNil(t, j.Entry())
+	assert.Equal(t, all[2].Message(), j.Entry().Message())
+
+	require.True(t, j.Next())
+	assert.Equal(t, all[3].Message(), j.Entry().Message())
+}
+
+func TestJournalUntilStops(t *testing.T) {
+	fsys := newJournalFs(t)
+
+	all := readJournal(t, fsys, aferoguestfs.JournalFilter{})
+	require.Len(t, all, 8)
+
+	var until int
+	for i, e := range all {
+		if e.Message() == "first message" {
+			until = i
+		}
+	}
+	require.Less(t, until, len(all)-1)
+
+	j, err := fsys.OpenJournal(aferoguestfs.DefaultJournalDir, aferoguestfs.JournalFilter{Until: all[until].Time})
+	require.Nil(t, err)
+	defer j.Close()
+
+	var n int
+	for j.Next() {
+		assert.False(t, j.Entry().Time.After(all[until].Time))
+		n++
+	}
+	require.Nil(t, j.Err())
+	assert.Equal(t, until+1, n)
+
+	// the journal stays at its end after Until
+	assert.False(t, j.Next())
+	assert.Nil(t, j.Entry())
+}
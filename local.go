@@ -0,0 +1,134 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"time"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// MountLocalOptions configure Fs.MountLocal.
+type MountLocalOptions struct {
+	// ReadOnly mounts the filesystem read-only on the host.
+	ReadOnly bool
+
+	// Options are extra comma separated FUSE mount options, e.g.
+	// "allow_other".
+	Options string
+
+	// CacheTimeout is how long the host caches file attributes and
+	// directory entries. Defaults to the libguestfs default of 60 seconds.
+	CacheTimeout time.Duration
+}
+
+// LocalMount is the guest filesystem mounted on the host by Fs.MountLocal.
+type LocalMount struct {
+	fs  *Fs
+	dir string
+
+	// done receives the result of Mount_local_run when it returns
+	done chan error
+}
+
+// MountLocal mounts the filesystem on the host directory hostDir with FUSE,
+// so that tools needing a real path can use it. Requests are served in a
+// goroutine through the same guestfs handle until the LocalMount is closed.
+// Only one local mount can be active per handle.
+func (fs *Fs) MountLocal(hostDir string, opts *MountLocalOptions) (*LocalMount, error) {
+	if opts == nil {
+		opts = &MountLocalOptions{}
+	}
+
+	fs.localMountMu.Lock()
+	defer fs.localMountMu.Unlock()
+
+	if fs.localMount != nil {
+		return nil, fmt.Errorf("already mounted on %s", fs.localMount.dir)
+	}
+
+	hostDir, err := filepath.Abs(hostDir)
+	if err != nil {
+		return nil, err
+	}
+
+	optargs := &guestfs.OptargsMount_local{
+		Readonly_is_set: opts.ReadOnly,
+		Readonly:        opts.ReadOnly,
+		Options_is_set:  opts.Options != "",
+		Options:         opts.Options,
+	}
+	if opts.CacheTimeout > 0 {
+		optargs.Cachetimeout_is_set = true
+		optargs.Cachetimeout = int(math.Ceil(opts.CacheTimeout.Seconds()))
+	}
+
+	if err := fs.guestfs.Mount_local(hostDir, optargs); err != nil {
+		return nil, fmt.Errorf("mount local %s failed: %w", hostDir, err)
+	}
+
+	m := &LocalMount{
+		fs:   fs,
+		dir:  hostDir,
+		done: make(chan error, 1),
+	}
+
+	go func() {
+		m.done <- fs.guestfs.Mount_local_run()
+	}()
+
+	fs.localMount = m
+	return m, nil
+}
+
+// currentLocalMount returns the active MountLocal, if any.
+func (fs *Fs) currentLocalMount() *LocalMount {
+	fs.localMountMu.Lock()
+	defer fs.localMountMu.Unlock()
+
+	return fs.localMount
+}
+
+// Dir returns the host directory the filesystem is mounted on.
+func (m *LocalMount) Dir() string {
+	return m.dir
+}
+
+// Close unmounts the filesystem from the host, retrying while it is busy, and
+// waits for the request loop to finish.
+func (m *LocalMount) Close() error {
+	m.fs.localMountMu.Lock()
+	defer m.fs.localMountMu.Unlock()
+
+	if m.fs.localMount != m {
+		return nil
+	}
+
+	select {
+	case err := <-m.done:
+		// unmounted from outside, e.g. with fusermount -u
+		m.fs.localMount = nil
+		if err != nil {
+			return fmt.Errorf("mount local run failed: %w", err)
+		}
+		return nil
+	default:
+	}
+
+	err := m.fs.guestfs.Umount_local(&guestfs.OptargsUmount_local{
+		Retry_is_set: true,
+		Retry:        true,
+	})
+	if err != nil {
+		return fmt.Errorf("umount local %s failed: %w", m.dir, err)
+	}
+
+	m.fs.localMount = nil
+	m.fs.invalidateAll()
+	if err := <-m.done; err != nil {
+		return fmt.Errorf("mount local run failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMountLocal(t *testing.T) {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("fuse not available")
+	}
+
+	fsys, err := aferoguestfs.OpenPartitionFs(newTest1Image(t), "/dev/sda2")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	require.Nil(t, afero.WriteFile(fsys, "/test.txt", []byte("some text"), 0644))
+
+	dir := t.TempDir()
+	m, err := fsys.MountLocal(dir, nil)
+	require.Nil(t, err)
+	assert.Equal(t, dir, m.Dir())
+
+	_, err = fsys.MountLocal(t.TempDir(), nil)
+	assert.NotNil(t, err)
+
+	bs, err := os.ReadFile(filepath.Join(dir, "test.txt"))
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(bs))
+
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "host.txt"), []byte("host text"), 0644))
+
+	require.Nil(t, m.Close())
+	require.Nil(t, m.Close())
+
+	bs, err = afero.ReadFile(fsys, "/host.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "host text", string(bs))
+}
+
+func TestMountLocalClosedWithPartitionFs(t *testing.T) {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("fuse not available")
+	}
+
+	fsys, err := aferoguestfs.OpenPartitionFs(newTest1Image(t), "/dev/sda2")
+	require.Nil(t, err)
+
+	dir := t.TempDir()
+	_, err = fsys.MountLocal(dir, &aferoguestfs.MountLocalOptions{ReadOnly: true})
+	require.Nil(t, err)
+
+	require.Nil(t, fsys.Close())
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestMountLocalConcurrentClose(t *testing.T) {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("fuse not available")
+	}
+
+	fsys, err := aferoguestfs.OpenPartitionFs(newTest1Image(t), "/dev/sda2")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	m, err := fsys.MountLocal(t.TempDir(), nil)
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.Close()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, []error{nil, nil}, errs)
+
+	// the handle can be mounted again
+	m, err = fsys.MountLocal(t.TempDir(), nil)
+	require.Nil(t, err)
+	assert.Nil(t, m.Close())
+}
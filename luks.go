@@ -0,0 +1,159 @@
+package aferoguestfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// Unlocker opens an encrypted device and maps it to /dev/mapper/<mapname>.
+// Use Passphrase, Keyfile, KeyFunc or Clevis to create one.
+type Unlocker struct {
+	unlock func(g *guestfs.Guestfs, device string, mapname string) error
+
+	// network is set when the appliance needs network access to unlock
+	network bool
+}
+
+// Passphrase returns an Unlocker that opens a LUKS device with a passphrase.
+func Passphrase(key string) Unlocker {
+	return KeyFunc(func(string) (string, error) {
+		return key, nil
+	})
+}
+
+// Keyfile returns an Unlocker that opens a LUKS device with the contents of a
+// key file on the host.
+//
+// The key never goes on a command line: Cryptsetup_open writes it to a
+// private file in the appliance, passes it to cryptsetup --key-file and
+// removes it. Keys are passed to the appliance as C strings though, so key
+// files containing NUL bytes are rejected rather than silently truncated.
+func Keyfile(path string) Unlocker {
+	return KeyFunc(func(string) (string, error) {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read key file: %w", err)
+		}
+		if bytes.IndexByte(key, 0) >= 0 {
+			return "", fmt.Errorf("key file %s contains a NUL byte, which can't be passed to the appliance", path)
+		}
+		return string(key), nil
+	})
+}
+
+// KeyFunc returns an Unlocker that opens a LUKS device with the key returned
+// by fn. It is called with the encrypted device, e.g. to prompt the user.
+func KeyFunc(fn func(device string) (string, error)) Unlocker {
+	return Unlocker{
+		unlock: func(g *guestfs.Guestfs, device string, mapname string) error {
+			key, err := fn(device)
+			if err != nil {
+				return err
+			}
+			return g.Cryptsetup_open(device, key, mapname, nil)
+		},
+	}
+}
+
+// Clevis returns an Unlocker that opens a LUKS device bound to Clevis, using
+// the Tang servers it was bound to. The appliance network is enabled to reach
+// them.
+func Clevis() Unlocker {
+	return Unlocker{
+		unlock: func(g *guestfs.Guestfs, device string, mapname string) error {
+			return g.Clevis_luks_unlock(device, mapname)
+		},
+		network: true,
+	}
+}
+
+// OpenEncryptedPartitionFs opens a new LUKS encrypted partition.
+// It takes a path to an image file, a partition device and an Unlocker that
+// opens the encrypted partition. The mapped device is closed by Close.
+func OpenEncryptedPartitionFs(image string, partition string, unlock Unlocker) (*PartitionFs, error) {
+	g, err := launch(image, unlock.network, false)
+	if err != nil {
+		return nil, err
+	}
+
+	mapname := "luks-" + filepath.Base(partition)
+	if err := unlock.unlock(g, partition, mapname); err != nil {
+		g.Close()
+		return nil, fmt.Errorf("failed to unlock partition %s: %w", partition, err)
+	}
+
+	mapped := "/dev/mapper/" + mapname
+
+	if err := g.Mount(mapped, "/"); err != nil {
+		g.Cryptsetup_close(mapped)
+		g.Close()
+		return nil, fmt.Errorf("failed to mount %s: %w", mapped, err)
+	}
+
+	p := &PartitionFs{
+		Fs:     New(g),
+		LVM:    NewLVM(g),
+		LUKS:   NewLUKS(g),
+		inner:  g,
+		mapped: []string{mapped},
+	}
+	p.mounts = []Mount{{Device: mapped, Mountpoint: "/"}}
+
+	// LUKS on logical volumes and whole devices has no partition table
+	if device, err := g.Part_to_dev(partition); err == nil {
+		p.Disk = NewDisk(g, device)
+	}
+
+	return p, nil
+}
+
+// LUKS manages LUKS encrypted devices.
+type LUKS struct {
+	guestfs *guestfs.Guestfs
+}
+
+// NewLUKS returns a LUKS for a launched guestfs handle.
+func NewLUKS(g *guestfs.Guestfs) *LUKS {
+	return &LUKS{
+		guestfs: g,
+	}
+}
+
+// Format formats device as a LUKS encrypted device with key in keyslot,
+// destroying any data on it.
+func (l *LUKS) Format(device string, key string, keyslot int) error {
+	if err := l.guestfs.Luks_format(device, key, keyslot); err != nil {
+		return fmt.Errorf("failed to format %s: %w", device, err)
+	}
+	return nil
+}
+
+// AddKey adds newkey in keyslot. key must be an existing key of the device.
+func (l *LUKS) AddKey(device string, key string, newkey string, keyslot int) error {
+	if err := l.guestfs.Luks_add_key(device, key, newkey, keyslot); err != nil {
+		return fmt.Errorf("failed to add key to %s: %w", device, err)
+	}
+	return nil
+}
+
+// RemoveKey removes the key in keyslot. key must be a key of the device in a
+// different slot.
+func (l *LUKS) RemoveKey(device string, key string, keyslot int) error {
+	if err := l.guestfs.Luks_kill_slot(device, key, keyslot); err != nil {
+		return fmt.Errorf("failed to remove key slot %d from %s: %w", keyslot, device, err)
+	}
+	return nil
+}
+
+// UUID returns the UUID of a LUKS device.
+func (l *LUKS) UUID(device string) (string, error) {
+	uuid, err := l.guestfs.Luks_uuid(device)
+	if err != nil {
+		return "", fmt.Errorf("failed to get uuid of %s: %w", device, err)
+	}
+	return uuid, nil
+}
@@ -0,0 +1,118 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLUKSImage(t *testing.T, key string) string {
+	return newImage(t, 64*1024*1024, func(g *guestfs.Guestfs) error {
+		if err := g.Part_disk("/dev/sda", "mbr"); err != nil {
+			return err
+		}
+		if err := aferoguestfs.NewLUKS(g).Format("/dev/sda1", key, 0); err != nil {
+			return err
+		}
+		if err := g.Cryptsetup_open("/dev/sda1", key, "test", nil); err != nil {
+			return err
+		}
+		if err := g.Mkfs("ext4", "/dev/mapper/test", nil); err != nil {
+			return err
+		}
+		return g.Cryptsetup_close("/dev/mapper/test")
+	})
+}
+
+func TestOpenEncryptedPartitionFs(t *testing.T) {
+	image := newLUKSImage(t, "secret")
+
+	fsys, err := aferoguestfs.OpenEncryptedPartitionFs(image, "/dev/sda1", aferoguestfs.Passphrase("secret"))
+	require.Nil(t, err)
+
+	require.Nil(t, afero.WriteFile(fsys, "test.txt", []byte("some text"), 0644))
+	body, err := afero.ReadFile(fsys, "test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(body))
+
+	assert.Nil(t, fsys.Close())
+}
+
+func TestOpenEncryptedPartitionFsWrongKey(t *testing.T) {
+	image := newLUKSImage(t, "secret")
+
+	_, err := aferoguestfs.OpenEncryptedPartitionFs(image, "/dev/sda1", aferoguestfs.Passphrase("wrong"))
+	assert.NotNil(t, err)
+}
+
+func TestLUKSAddKey(t *testing.T) {
+	image := newLUKSImage(t, "secret")
+
+	fsys, err := aferoguestfs.OpenEncryptedPartitionFs(image, "/dev/sda1", aferoguestfs.KeyFunc(func(device string) (string, error) {
+		assert.Equal(t, "/dev/sda1", device)
+		return "secret", nil
+	}))
+	require.Nil(t, err)
+
+	err = fsys.LUKS.AddKey("/dev/sda1", "secret", "other", 1)
+	assert.Nil(t, err)
+
+	err = fsys.LUKS.RemoveKey("/dev/sda1", "other", 0)
+	assert.Nil(t, err)
+
+	require.Nil(t, fsys.Close())
+
+	fsys, err = aferoguestfs.OpenEncryptedPartitionFs(image, "/dev/sda1", aferoguestfs.Passphrase("other"))
+	require.Nil(t, err)
+	assert.Nil(t, fsys.Close())
+
+	_, err = aferoguestfs.OpenEncryptedPartitionFs(image, "/dev/sda1", aferoguestfs.Passphrase("secret"))
+	assert.NotNil(t, err)
+}
+
+func TestOpenEncryptedPartitionFsKeyfile(t *testing.T) {
+	image := newLUKSImage(t, "secret")
+	dir := t.TempDir()
+
+	keyfile := filepath.Join(dir, "key")
+	require.Nil(t, os.WriteFile(keyfile, []byte("secret"), 0600))
+
+	fsys, err := aferoguestfs.OpenEncryptedPartitionFs(image, "/dev/sda1", aferoguestfs.Keyfile(keyfile))
+	require.Nil(t, err)
+	assert.Nil(t, fsys.Close())
+
+	// a key that only matches when truncated at the NUL byte
+	truncated := filepath.Join(dir, "truncated")
+	require.Nil(t, os.WriteFile(truncated, []byte("secret\x00other"), 0600))
+
+	_, err = aferoguestfs.OpenEncryptedPartitionFs(image, "/dev/sda1", aferoguestfs.Keyfile(truncated))
+	assert.NotNil(t, err)
+}
+
+func TestOpenEncryptedPartitionFsWholeDisk(t *testing.T) {
+	image := newImage(t, 64*1024*1024, func(g *guestfs.Guestfs) error {
+		if err := aferoguestfs.NewLUKS(g).Format("/dev/sda", "secret", 0); err != nil {
+			return err
+		}
+		if err := g.Cryptsetup_open("/dev/sda", "secret", "test", nil); err != nil {
+			return err
+		}
+		if err := g.Mkfs("ext4", "/dev/mapper/test", nil); err != nil {
+			return err
+		}
+		return g.Cryptsetup_close("/dev/mapper/test")
+	})
+
+	fsys, err := aferoguestfs.OpenEncryptedPartitionFs(image, "/dev/sda", aferoguestfs.Passphrase("secret"))
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	assert.Nil(t, fsys.Disk)
+	require.Nil(t, afero.WriteFile(fsys, "test.txt", []byte("some text"), 0644))
+}
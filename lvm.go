@@ -0,0 +1,134 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// VolumeGroup describes an LVM volume group. Sizes are in bytes.
+type VolumeGroup struct {
+	Name string
+	UUID string
+	Size uint64
+	Free uint64
+}
+
+// LogicalVolume describes an LVM logical volume. Size is in bytes.
+type LogicalVolume struct {
+	Name        string
+	VolumeGroup string
+	UUID        string
+	Size        uint64
+
+	// Device is the canonical device name, e.g. "/dev/vg/lv".
+	Device string
+}
+
+// LVM gives access to the LVM volume groups and logical volumes visible to a
+// guestfs handle.
+type LVM struct {
+	guestfs *guestfs.Guestfs
+}
+
+// NewLVM returns an LVM for a launched guestfs handle.
+func NewLVM(g *guestfs.Guestfs) *LVM {
+	return &LVM{
+		guestfs: g,
+	}
+}
+
+// Scan rescans the devices for volume groups and activates all logical
+// volumes.
+func (l *LVM) Scan() error {
+	if err := l.guestfs.Vgscan(); err != nil {
+		return fmt.Errorf("vgscan failed: %w", err)
+	}
+	if err := l.guestfs.Vg_activate_all(true); err != nil {
+		return fmt.Errorf("failed to activate volume groups: %w", err)
+	}
+	return nil
+}
+
+// VolumeGroups returns all volume groups.
+func (l *LVM) VolumeGroups() ([]VolumeGroup, error) {
+	vgs, err := l.guestfs.Vgs_full()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume groups: %w", err)
+	}
+
+	ret := make([]VolumeGroup, 0, len(*vgs))
+	for _, vg := range *vgs {
+		ret = append(ret, VolumeGroup{
+			Name: vg.Vg_name,
+			UUID: string(vg.Vg_uuid[:]),
+			Size: vg.Vg_size,
+			Free: vg.Vg_free,
+		})
+	}
+
+	return ret, nil
+}
+
+// LogicalVolumes returns all logical volumes of all volume groups.
+func (l *LVM) LogicalVolumes() ([]LogicalVolume, error) {
+	lvs, err := l.guestfs.Lvs_full()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logical volumes: %w", err)
+	}
+
+	vgs, err := l.guestfs.Vgs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume groups: %w", err)
+	}
+
+	// Lvs_full doesn't report the volume group, match it by uuid instead
+	vgByLVUUID := map[string]string{}
+	for _, vg := range vgs {
+		uuids, err := l.guestfs.Vglvuuids(vg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list logical volumes of %s: %w", vg, err)
+		}
+		for _, uuid := range uuids {
+			vgByLVUUID[uuid] = vg
+		}
+	}
+
+	ret := make([]LogicalVolume, 0, len(*lvs))
+	for _, lv := range *lvs {
+		uuid := string(lv.Lv_uuid[:])
+		vg := vgByLVUUID[uuid]
+		ret = append(ret, LogicalVolume{
+			Name:        lv.Lv_name,
+			VolumeGroup: vg,
+			UUID:        uuid,
+			Size:        lv.Lv_size,
+			Device:      path.Join("/dev", vg, lv.Lv_name),
+		})
+	}
+
+	return ret, nil
+}
+
+// LogicalVolumeDevice resolves a volume group and logical volume name to the
+// canonical device of the logical volume.
+func (l *LVM) LogicalVolumeDevice(vg string, lv string) (string, error) {
+	device, err := l.guestfs.Lvm_canonical_lv_name(path.Join("/dev", vg, lv))
+	if err != nil {
+		return "", fmt.Errorf("logical volume %s/%s not found: %w", vg, lv, err)
+	}
+
+	lvs, err := l.guestfs.Lvs()
+	if err != nil {
+		return "", fmt.Errorf("failed to list logical volumes: %w", err)
+	}
+
+	for _, d := range lvs {
+		if d == device {
+			return device, nil
+		}
+	}
+
+	return "", fmt.Errorf("logical volume %s/%s not found", vg, lv)
+}
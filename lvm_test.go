@@ -0,0 +1,73 @@
+package aferoguestfs_test
+
+import (
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLVMImage(t *testing.T) string {
+	return newImage(t, 64*1024*1024, func(g *guestfs.Guestfs) error {
+		if err := g.Part_disk("/dev/sda", "mbr"); err != nil {
+			return err
+		}
+		if err := g.Pvcreate("/dev/sda1"); err != nil {
+			return err
+		}
+		if err := g.Vgcreate("vg0", []string{"/dev/sda1"}); err != nil {
+			return err
+		}
+		if err := g.Lvcreate("root", "vg0", 16); err != nil {
+			return err
+		}
+		return g.Mkfs("ext4", "/dev/vg0/root", nil)
+	})
+}
+
+func TestOpenLogicalVolumeFs(t *testing.T) {
+	image := newLVMImage(t)
+
+	fsys, err := aferoguestfs.OpenLogicalVolumeFs(image, "vg0", "root")
+	require.Nil(t, err)
+
+	require.Nil(t, afero.WriteFile(fsys, "test.txt", []byte("some text"), 0644))
+	body, err := afero.ReadFile(fsys, "test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(body))
+
+	assert.Nil(t, fsys.Close())
+}
+
+func TestOpenLogicalVolumeFsNotFound(t *testing.T) {
+	image := newLVMImage(t)
+
+	_, err := aferoguestfs.OpenLogicalVolumeFs(image, "vg0", "missing")
+	assert.NotNil(t, err)
+}
+
+func TestLVMList(t *testing.T) {
+	image := newLVMImage(t)
+
+	fsys, err := aferoguestfs.OpenLogicalVolumeFs(image, "vg0", "root")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	vgs, err := fsys.LVM.VolumeGroups()
+	require.Nil(t, err)
+	require.Len(t, vgs, 1)
+	assert.Equal(t, "vg0", vgs[0].Name)
+	assert.Len(t, vgs[0].UUID, 32)
+	assert.Greater(t, vgs[0].Size, uint64(0))
+
+	lvs, err := fsys.LVM.LogicalVolumes()
+	require.Nil(t, err)
+	require.Len(t, lvs, 1)
+	assert.Equal(t, "root", lvs[0].Name)
+	assert.Equal(t, "vg0", lvs[0].VolumeGroup)
+	assert.Equal(t, "/dev/vg0/root", lvs[0].Device)
+	assert.Equal(t, uint64(16*1024*1024), lvs[0].Size)
+}
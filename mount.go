@@ -0,0 +1,126 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// Mount is an entry of a mount table.
+type Mount struct {
+	// Device is a mountable, e.g. "/dev/sda1" or "/dev/vg/lv".
+	Device string
+
+	// Mountpoint is an absolute path in the guest filesystem.
+	Mountpoint string
+
+	// Options are comma separated mount options as accepted by mount(8).
+	Options string
+
+	ReadOnly bool
+}
+
+// MountAll mounts every entry of a mount table. Entries are mounted parents
+// first regardless of their order in mounts. Mountpoints that don't exist are
+// created in the parent filesystem.
+func MountAll(g *guestfs.Guestfs, mounts []Mount) error {
+	mounts = append([]Mount(nil), mounts...)
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return mountDepth(mounts[i].Mountpoint) < mountDepth(mounts[j].Mountpoint)
+	})
+
+	for _, m := range mounts {
+		mountpoint := normalizePath(m.Mountpoint)
+
+		if mountpoint != "/" {
+			if err := g.Mkdir_p(mountpoint); err != nil {
+				return fmt.Errorf("failed to create mountpoint %s: %w", mountpoint, err)
+			}
+		}
+
+		options := m.Options
+		if m.ReadOnly {
+			options = strings.TrimPrefix(options+",ro", ",")
+		}
+
+		if err := g.Mount_options(options, m.Device, mountpoint); err != nil {
+			return fmt.Errorf("failed to mount %s at %s: %w", m.Device, mountpoint, err)
+		}
+	}
+
+	return nil
+}
+
+// OpenMountTableFs opens a disk image and mounts every entry of a mount table.
+// The mount table must have an entry for "/". If every entry is read-only,
+// the image is also added read-only, so it isn't modified at all.
+func OpenMountTableFs(image string, mounts []Mount) (*PartitionFs, error) {
+	hasRoot := false
+	readOnly := true
+	for _, m := range mounts {
+		if normalizePath(m.Mountpoint) == "/" {
+			hasRoot = true
+		}
+		if !m.ReadOnly {
+			readOnly = false
+		}
+	}
+	if !hasRoot {
+		return nil, fmt.Errorf("mount table has no entry for /")
+	}
+
+	g, err := launch(image, false, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	lvm := NewLVM(g)
+	if err := lvm.Scan(); err != nil {
+		g.Close()
+		return nil, err
+	}
+
+	if err := MountAll(g, mounts); err != nil {
+		g.Umount_all()
+		g.Close()
+		return nil, err
+	}
+
+	p := &PartitionFs{Fs: New(g), LVM: lvm, LUKS: NewLUKS(g), inner: g}
+	p.mounts = mounts
+	return p, nil
+}
+
+// mountDepth returns the number of path components of a mountpoint.
+func mountDepth(mountpoint string) int {
+	mountpoint = normalizePath(mountpoint)
+	if mountpoint == "/" {
+		return 0
+	}
+	return strings.Count(mountpoint, "/")
+}
+
+// isShadowed reports whether path, relative to the root, is hidden by a
+// filesystem mounted below mountpoint.
+func isShadowed(path string, mountpoint string, mountpoints []string) bool {
+	path = normalizePath(path)
+	for _, mp := range mountpoints {
+		if mp == mountpoint || !isUnder(mp, mountpoint) {
+			continue
+		}
+		if path == mp || isUnder(path, mp) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnder reports whether path is strictly below dir. Both must be normalized.
+func isUnder(path string, dir string) bool {
+	if dir == "/" {
+		return path != "/"
+	}
+	return strings.HasPrefix(path, dir+"/")
+}
@@ -0,0 +1,91 @@
+package aferoguestfs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenMountTableFs(t *testing.T) {
+	image := newTest1Image(t)
+
+	fsys, err := aferoguestfs.OpenMountTableFs(image, []aferoguestfs.Mount{
+		{Device: "/dev/sda1", Mountpoint: "/boot"},
+		{Device: "/dev/sda2", Mountpoint: "/"},
+	})
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	require.Nil(t, afero.WriteFile(fsys, "boot/test1.txt", []byte("some text"), os.ModePerm))
+	require.Nil(t, afero.WriteFile(fsys, "test2.txt", []byte("some more text"), os.ModePerm))
+
+	paths, err := fsys.AllPaths()
+	require.Nil(t, err)
+
+	assert.Contains(t, paths, ".")
+	assert.Contains(t, paths, "boot")
+	assert.Contains(t, paths, "boot/test1.txt")
+	assert.Contains(t, paths, "test2.txt")
+
+	seen := map[string]bool{}
+	for _, p := range paths {
+		assert.False(t, seen[p], "duplicate path %s", p)
+		seen[p] = true
+	}
+
+	rootStat, err := fsys.Statfs("/")
+	require.Nil(t, err)
+	bootStat, err := fsys.Statfs("/boot")
+	require.Nil(t, err)
+	assert.NotEqual(t, rootStat.Fsid, bootStat.Fsid)
+
+	buf := bytes.NewBuffer(nil)
+	require.Nil(t, fsys.TarOut("/", buf))
+
+	var names []string
+	tr := tar.NewReader(buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		names = append(names, hdr.Name)
+	}
+
+	assert.Contains(t, names, "./boot/test1.txt")
+	assert.Contains(t, names, "./test2.txt")
+}
+
+func TestOpenMountTableFsReadOnly(t *testing.T) {
+	image := newTest1Image(t)
+
+	fsys, err := aferoguestfs.OpenMountTableFs(image, []aferoguestfs.Mount{
+		{Device: "/dev/sda2", Mountpoint: "/"},
+		{Device: "/dev/sda1", Mountpoint: "/boot", ReadOnly: true},
+	})
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	err = afero.WriteFile(fsys, "boot/test.txt", []byte("some text"), os.ModePerm)
+	assert.NotNil(t, err)
+
+	err = afero.WriteFile(fsys, "test.txt", []byte("some text"), os.ModePerm)
+	assert.Nil(t, err)
+}
+
+func TestOpenMountTableFsNoRoot(t *testing.T) {
+	image := newTest1Image(t)
+
+	_, err := aferoguestfs.OpenMountTableFs(image, []aferoguestfs.Mount{
+		{Device: "/dev/sda1", Mountpoint: "/boot"},
+	})
+	assert.NotNil(t, err)
+}
@@ -1,6 +1,7 @@
 package aferoguestfs
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
@@ -9,41 +10,172 @@ import (
 // PartitionFs is a utility type for opening a partition in a disk image.
 type PartitionFs struct {
 	*Fs
+
+	// Disk is the partition table of the disk containing the partition. It is
+	// nil when the filesystem is not on a partition, e.g. on a logical volume,
+	// or when it was opened from a mount table.
+	Disk *Disk
+
+	// LVM gives access to the LVM volume groups and logical volumes of the
+	// image.
+	LVM *LVM
+
+	// LUKS manages the LUKS encrypted devices of the image.
+	LUKS *LUKS
+
 	inner *guestfs.Guestfs
+
+	// mapped are the opened encrypted devices to close on Close
+	mapped []string
 }
 
 // OpenPartitionFs opens a new partition.
 // It takes a path to an image file and a partition device.
 func OpenPartitionFs(image string, partition string) (*PartitionFs, error) {
-	g, err := guestfs.Create()
+	return openPartitionFs(image, partition, false)
+}
+
+// OpenNetworkPartitionFs is like OpenPartitionFs but enables the appliance
+// network, e.g. for RsyncIn and RsyncOut. These assume libguestfs' default
+// user mode network, where the host is reachable at 10.0.2.2.
+func OpenNetworkPartitionFs(image string, partition string) (*PartitionFs, error) {
+	return openPartitionFs(image, partition, true)
+}
+
+func openPartitionFs(image string, partition string, network bool) (*PartitionFs, error) {
+	g, err := launch(image, network, false)
 	if err != nil {
-		return nil, fmt.Errorf("create failed: %w", err)
+		return nil, err
 	}
 
-	if err := g.Add_drive(image, nil); err != nil {
+	if err := g.Mount(partition, "/"); err != nil {
 		g.Close()
-		return nil, fmt.Errorf("add drive failed: %w", err)
+		return nil, fmt.Errorf("failed to mount partition %s: %w", partition, err)
 	}
 
-	if err := g.Launch(); err != nil {
+	return newPartitionFs(g, Mount{Device: partition, Mountpoint: "/"})
+}
+
+// OpenBtrfsSubvolumeFs opens a subvolume of a btrfs partition.
+// It takes a path to an image file, a partition device and a subvolume path
+// relative to the top-level subvolume.
+func OpenBtrfsSubvolumeFs(image string, partition string, subvolume string) (*PartitionFs, error) {
+	g, err := launch(image, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.Mount_options("subvol="+subvolume, partition, "/"); err != nil {
 		g.Close()
-		return nil, fmt.Errorf("launch failed: %w", err)
+		return nil, fmt.Errorf("failed to mount subvolume %s of %s: %w", subvolume, partition, err)
 	}
 
-	if err := g.Mount(partition, "/"); err != nil {
+	return newPartitionFs(g, Mount{Device: partition, Mountpoint: "/", Options: "subvol=" + subvolume})
+}
+
+// OpenLogicalVolumeFs opens a new LVM logical volume.
+// It takes a path to an image file, a volume group name and a logical volume
+// name.
+func OpenLogicalVolumeFs(image string, vg string, lv string) (*PartitionFs, error) {
+	g, err := launch(image, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	lvm := NewLVM(g)
+	if err := lvm.Scan(); err != nil {
 		g.Close()
-		return nil, fmt.Errorf("failed to mount partition %s: %w", partition, err)
+		return nil, err
+	}
+
+	device, err := lvm.LogicalVolumeDevice(vg, lv)
+	if err != nil {
+		g.Close()
+		return nil, err
 	}
 
-	return &PartitionFs{Fs: New(g), inner: g}, nil
+	if err := g.Mount(device, "/"); err != nil {
+		g.Close()
+		return nil, fmt.Errorf("failed to mount logical volume %s: %w", device, err)
+	}
+
+	p := &PartitionFs{Fs: New(g), LVM: lvm, LUKS: NewLUKS(g), inner: g}
+	p.mounts = []Mount{{Device: device, Mountpoint: "/"}}
+	return p, nil
 }
 
 func (p *PartitionFs) Close() error {
+	// keep going after errors so the handle is always closed
+	var errs []error
+	if m := p.currentLocalMount(); m != nil {
+		if err := m.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if err := p.inner.Umount_all(); err != nil {
-		return fmt.Errorf("umount all failed: %w", err)
+		errs = append(errs, fmt.Errorf("umount all failed: %w", err))
+	}
+	for _, m := range p.mapped {
+		if err := p.inner.Cryptsetup_close(m); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", m, err))
+		}
 	}
 	if err := p.inner.Close(); err != nil {
-		return fmt.Errorf("guestfs close failed: %w", err)
+		errs = append(errs, fmt.Errorf("guestfs close failed: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// newPartitionFs returns a PartitionFs for a launched guestfs handle with the
+// partition of m mounted at the root. The partition may also be a btrfs
+// subvolume mountable such as "btrfsvol:/dev/sda2/root".
+func newPartitionFs(g *guestfs.Guestfs, m Mount) (*PartitionFs, error) {
+	device, err := g.Mountable_device(m.Device)
+	if err != nil {
+		g.Umount_all()
+		g.Close()
+		return nil, fmt.Errorf("failed to get device of mountable %s: %w", m.Device, err)
+	}
+
+	p := &PartitionFs{Fs: New(g), LVM: NewLVM(g), LUKS: NewLUKS(g), inner: g}
+	p.mounts = []Mount{m}
+
+	// logical volumes and whole devices have no partition table
+	if disk, err := g.Part_to_dev(device); err == nil {
+		p.Disk = NewDisk(g, disk)
+	}
+
+	return p, nil
+}
+
+// launch creates a guestfs handle with image added as a drive and launches
+// the appliance, optionally with network access. A read-only drive is never
+// written to, not even by journal replay when mounting.
+func launch(image string, network bool, readOnly bool) (*guestfs.Guestfs, error) {
+	g, err := guestfs.Create()
+	if err != nil {
+		return nil, fmt.Errorf("create failed: %w", err)
+	}
+
+	if network {
+		if err := g.Set_network(true); err != nil {
+			g.Close()
+			return nil, fmt.Errorf("enable network failed: %w", err)
+		}
+	}
+
+	if err := g.Add_drive(image, &guestfs.OptargsAdd_drive{
+		Readonly_is_set: readOnly,
+		Readonly:        readOnly,
+	}); err != nil {
+		g.Close()
+		return nil, fmt.Errorf("add drive failed: %w", err)
+	}
+
+	if err := g.Launch(); err != nil {
+		g.Close()
+		return nil, fmt.Errorf("launch failed: %w", err)
 	}
-	return nil
+
+	return g, nil
 }
@@ -0,0 +1,111 @@
+package aferoguestfs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// maxSymlinks is the most symlinks followed while resolving a path, as in
+// Linux.
+const maxSymlinks = 40
+
+// EvalSymlinks returns name with all symlinks resolved in the guest's
+// namespace: absolute targets are relative to the guest root, and ".." never
+// leaves it. The file must exist.
+func (fs *Fs) EvalSymlinks(name string) (string, error) {
+	resolved, err := fs.resolveIn("/", name, true)
+	if err != nil {
+		return "", err
+	}
+
+	if err := fs.exists(resolved); err != nil {
+		return "", err
+	}
+
+	return resolved, nil
+}
+
+// RealPath is like EvalSymlinks but the last component of name, or the
+// target of a final symlink, doesn't have to exist, like realpath(1).
+func (fs *Fs) RealPath(name string) (string, error) {
+	return fs.resolveIn("/", name, true)
+}
+
+// resolveIn resolves name relative to the directory root, following
+// symlinks one component at a time with root as the root directory, so the
+// result is always below root. The last component is only followed if
+// followLast is set and may be missing.
+func (fs *Fs) resolveIn(root string, name string, followLast bool) (string, error) {
+	root = fs.resolvePath(root)
+
+	// resolved is relative to root and contains no symlinks
+	resolved := ""
+	pending := splitPath(name)
+	links := 0
+
+	for len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+
+		if c == ".." {
+			resolved = path.Dir(resolved)
+			if resolved == "." {
+				resolved = ""
+			}
+			continue
+		}
+
+		next := path.Join(resolved, c)
+		last := len(pending) == 0
+		if last && !followLast {
+			resolved = next
+			break
+		}
+
+		full := path.Join(root, next)
+		info, err := fs.Lstat(full)
+		if last && errors.Is(err, os.ErrNotExist) {
+			resolved = next
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", &os.PathError{Op: "resolve", Path: name, Err: syscall.ELOOP}
+		}
+
+		target, err := fs.Readlink(full)
+		if err != nil {
+			return "", err
+		}
+
+		if path.IsAbs(target) {
+			resolved = ""
+		}
+		pending = append(splitPath(target), pending...)
+	}
+
+	return path.Join(root, resolved), nil
+}
+
+// splitPath returns the components of p without empty and "." components.
+func splitPath(p string) []string {
+	var ret []string
+	for _, c := range strings.Split(p, "/") {
+		if c != "" && c != "." {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
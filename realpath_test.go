@@ -0,0 +1,46 @@
+package aferoguestfs_test
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalSymlinks(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.MkdirAll("/etc/alternatives", 0755))
+	require.Nil(t, gfs.MkdirAll("/usr/bin", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "/usr/bin/vim.basic", []byte("vim"), 0755))
+	require.Nil(t, gfs.Symlink("/usr/bin/vim.basic", "/etc/alternatives/editor"))
+	require.Nil(t, gfs.Symlink("../../etc/alternatives/editor", "/usr/bin/editor"))
+	require.Nil(t, gfs.Symlink("../../../../usr", "/etc/usr"))
+	require.Nil(t, gfs.Symlink("loop2", "/loop1"))
+	require.Nil(t, gfs.Symlink("loop1", "/loop2"))
+
+	p, err := gfs.EvalSymlinks("/usr/bin/editor")
+	require.Nil(t, err)
+	assert.Equal(t, "/usr/bin/vim.basic", p)
+
+	// ".." doesn't leave the root
+	p, err = gfs.EvalSymlinks("/etc/usr/bin/editor")
+	require.Nil(t, err)
+	assert.Equal(t, "/usr/bin/vim.basic", p)
+
+	_, err = gfs.EvalSymlinks("/loop1")
+	assert.True(t, errors.Is(err, syscall.ELOOP))
+
+	_, err = gfs.EvalSymlinks("/usr/bin/missing")
+	assert.NotNil(t, err)
+
+	p, err = gfs.RealPath("/etc/usr/bin/missing")
+	require.Nil(t, err)
+	assert.Equal(t, "/usr/bin/missing", p)
+
+	_, err = gfs.RealPath("/etc/missing/file")
+	assert.NotNil(t, err)
+}
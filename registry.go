@@ -0,0 +1,375 @@
+package aferoguestfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// ValueType is the type of a registry value.
+type ValueType int64
+
+// Registry value types.
+const (
+	RegNone             ValueType = 0
+	RegSz               ValueType = 1
+	RegExpandSz         ValueType = 2
+	RegBinary           ValueType = 3
+	RegDword            ValueType = 4
+	RegDwordBigEndian   ValueType = 5
+	RegLink             ValueType = 6
+	RegMultiSz          ValueType = 7
+	RegResourceList     ValueType = 8
+	RegFullResourceDesc ValueType = 9
+	RegResourceReqList  ValueType = 10
+	RegQword            ValueType = 11
+)
+
+// Registry is a Windows registry hive file opened with hivex.
+//
+// Only one hive can be open per guestfs handle at a time.
+type Registry struct {
+	guestfs *guestfs.Guestfs
+	path    string
+}
+
+// Key is a key (node) of a registry hive.
+type Key struct {
+	registry *Registry
+	node     int64
+}
+
+// Value is a value of a registry key.
+type Value struct {
+	Name string
+	Type ValueType
+	Data []byte
+}
+
+// OpenRegistry opens the registry hive file at name, e.g.
+// "/Windows/System32/config/SOFTWARE". If write is set, the hive can be
+// modified and the changes are written back to the file by Commit.
+func (fs *Fs) OpenRegistry(name string, write bool) (*Registry, error) {
+	name = fs.resolvePath(name)
+
+	err := fs.guestfs.Hivex_open(name, &guestfs.OptargsHivex_open{
+		Write_is_set: true,
+		Write:        write,
+	})
+	if err != nil {
+		return nil, wrapErr(err, name)
+	}
+
+	return &Registry{
+		guestfs: fs.guestfs,
+		path:    name,
+	}, nil
+}
+
+// Close closes the hive, discarding uncommitted changes.
+func (r *Registry) Close() error {
+	if err := r.guestfs.Hivex_close(); err != nil {
+		return fmt.Errorf("failed to close hive %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// Commit writes the changes back to the hive file.
+func (r *Registry) Commit() error {
+	if err := r.guestfs.Hivex_commit(nil); err != nil {
+		return fmt.Errorf("failed to commit hive %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// Root returns the root key of the hive.
+func (r *Registry) Root() (*Key, error) {
+	node, err := r.guestfs.Hivex_root()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root of hive %s: %w", r.path, err)
+	}
+	return &Key{registry: r, node: node}, nil
+}
+
+// Key returns the key at path relative to the root of the hive. Path
+// components are separated by backslashes or slashes and matched case
+// insensitively, e.g. `Microsoft\Windows NT\CurrentVersion`.
+func (r *Registry) Key(path string) (*Key, error) {
+	k, err := r.Root()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range splitKeyPath(path) {
+		if k, err = k.Subkey(name); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// CreateKey returns the key at path, creating missing keys along the way.
+func (r *Registry) CreateKey(path string) (*Key, error) {
+	k, err := r.Root()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range splitKeyPath(path) {
+		child, err := k.Subkey(name)
+		if os.IsNotExist(err) {
+			child, err = k.CreateSubkey(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		k = child
+	}
+
+	return k, nil
+}
+
+// Name returns the name of the key.
+func (k *Key) Name() (string, error) {
+	name, err := k.registry.guestfs.Hivex_node_name(k.node)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key name: %w", err)
+	}
+	return name, nil
+}
+
+// Subkeys returns the child keys of the key.
+func (k *Key) Subkeys() ([]*Key, error) {
+	children, err := k.registry.guestfs.Hivex_node_children(k.node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subkeys: %w", err)
+	}
+
+	ret := make([]*Key, 0, len(*children))
+	for _, c := range *children {
+		ret = append(ret, &Key{registry: k.registry, node: c.Hivex_node_h})
+	}
+
+	return ret, nil
+}
+
+// Subkey returns the child key called name.
+func (k *Key) Subkey(name string) (*Key, error) {
+	node, err := k.registry.guestfs.Hivex_node_get_child(k.node, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subkey %s: %w", name, err)
+	}
+	if node == 0 {
+		return nil, fmt.Errorf("subkey %s: %w", name, os.ErrNotExist)
+	}
+	return &Key{registry: k.registry, node: node}, nil
+}
+
+// CreateSubkey adds a child key called name.
+func (k *Key) CreateSubkey(name string) (*Key, error) {
+	node, err := k.registry.guestfs.Hivex_node_add_child(k.node, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subkey %s: %w", name, err)
+	}
+	return &Key{registry: k.registry, node: node}, nil
+}
+
+// Delete deletes the key and all its subkeys and values.
+func (k *Key) Delete() error {
+	if err := k.registry.guestfs.Hivex_node_delete_child(k.node); err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+	return nil
+}
+
+// Values returns all values of the key.
+func (k *Key) Values() ([]Value, error) {
+	handles, err := k.registry.guestfs.Hivex_node_values(k.node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list values: %w", err)
+	}
+
+	ret := make([]Value, 0, len(*handles))
+	for _, h := range *handles {
+		v, err := k.readValue(h.Hivex_value_h)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *v)
+	}
+
+	return ret, nil
+}
+
+// Value returns the value called name. The default value of a key is called
+// "".
+func (k *Key) Value(name string) (*Value, error) {
+	h, err := k.registry.guestfs.Hivex_node_get_value(k.node, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value %s: %w", name, err)
+	}
+	if h == 0 {
+		return nil, fmt.Errorf("value %s: %w", name, os.ErrNotExist)
+	}
+	return k.readValue(h)
+}
+
+// SetValue sets the value called name, replacing any existing value.
+func (k *Key) SetValue(v Value) error {
+	if err := k.registry.guestfs.Hivex_node_set_value(k.node, v.Name, int64(v.Type), v.Data); err != nil {
+		return fmt.Errorf("failed to set value %s: %w", v.Name, err)
+	}
+	return nil
+}
+
+// GetString returns a REG_SZ or REG_EXPAND_SZ value.
+func (k *Key) GetString(name string) (string, error) {
+	v, err := k.Value(name)
+	if err != nil {
+		return "", err
+	}
+	return v.StringValue()
+}
+
+// SetString sets a REG_SZ value.
+func (k *Key) SetString(name string, s string) error {
+	return k.SetValue(Value{Name: name, Type: RegSz, Data: encodeUTF16(s)})
+}
+
+// GetDword returns a REG_DWORD value.
+func (k *Key) GetDword(name string) (uint32, error) {
+	v, err := k.Value(name)
+	if err != nil {
+		return 0, err
+	}
+	return v.Dword()
+}
+
+// SetDword sets a REG_DWORD value.
+func (k *Key) SetDword(name string, d uint32) error {
+	return k.SetValue(Value{Name: name, Type: RegDword, Data: binary.LittleEndian.AppendUint32(nil, d)})
+}
+
+// GetMultiString returns a REG_MULTI_SZ value.
+func (k *Key) GetMultiString(name string) ([]string, error) {
+	v, err := k.Value(name)
+	if err != nil {
+		return nil, err
+	}
+	return v.MultiString()
+}
+
+// SetMultiString sets a REG_MULTI_SZ value.
+func (k *Key) SetMultiString(name string, ss []string) error {
+	var data []byte
+	for _, s := range ss {
+		data = append(data, encodeUTF16(s)...)
+	}
+	data = append(data, 0, 0)
+	return k.SetValue(Value{Name: name, Type: RegMultiSz, Data: data})
+}
+
+// GetBinary returns the raw data of a value of any type.
+func (k *Key) GetBinary(name string) ([]byte, error) {
+	v, err := k.Value(name)
+	if err != nil {
+		return nil, err
+	}
+	return v.Data, nil
+}
+
+// SetBinary sets a REG_BINARY value.
+func (k *Key) SetBinary(name string, data []byte) error {
+	return k.SetValue(Value{Name: name, Type: RegBinary, Data: data})
+}
+
+// StringValue decodes a REG_SZ or REG_EXPAND_SZ value. It isn't called String
+// so that Value doesn't look like a fmt.Stringer.
+func (v *Value) StringValue() (string, error) {
+	if v.Type != RegSz && v.Type != RegExpandSz {
+		return "", fmt.Errorf("value %s has type %d, not a string", v.Name, v.Type)
+	}
+	return strings.TrimRight(decodeUTF16(v.Data), "\x00"), nil
+}
+
+// Dword decodes a REG_DWORD or REG_DWORD_BIG_ENDIAN value.
+func (v *Value) Dword() (uint32, error) {
+	if len(v.Data) != 4 {
+		return 0, fmt.Errorf("value %s has %d bytes, not a dword", v.Name, len(v.Data))
+	}
+
+	switch v.Type {
+	case RegDword:
+		return binary.LittleEndian.Uint32(v.Data), nil
+	case RegDwordBigEndian:
+		return binary.BigEndian.Uint32(v.Data), nil
+	}
+
+	return 0, fmt.Errorf("value %s has type %d, not a dword", v.Name, v.Type)
+}
+
+// MultiString decodes a REG_MULTI_SZ value.
+func (v *Value) MultiString() ([]string, error) {
+	if v.Type != RegMultiSz {
+		return nil, fmt.Errorf("value %s has type %d, not a multi string", v.Name, v.Type)
+	}
+
+	ret := []string{}
+	for _, s := range strings.Split(decodeUTF16(v.Data), "\x00") {
+		if s == "" {
+			break
+		}
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+func (k *Key) readValue(h int64) (*Value, error) {
+	name, err := k.registry.guestfs.Hivex_value_key(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get value name: %w", err)
+	}
+
+	typ, err := k.registry.guestfs.Hivex_value_type(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get type of value %s: %w", name, err)
+	}
+
+	data, err := k.registry.guestfs.Hivex_value_value(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data of value %s: %w", name, err)
+	}
+
+	return &Value{Name: name, Type: ValueType(typ), Data: data}, nil
+}
+
+func splitKeyPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool {
+		return r == '\\' || r == '/'
+	})
+}
+
+// encodeUTF16 encodes s as null terminated UTF-16LE.
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s + "\x00"))
+	ret := make([]byte, 0, len(u)*2)
+	for _, c := range u {
+		ret = binary.LittleEndian.AppendUint16(ret, c)
+	}
+	return ret
+}
+
+// decodeUTF16 decodes UTF-16LE data, ignoring a trailing odd byte.
+func decodeUTF16(data []byte) string {
+	u := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		u = append(u, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,168 @@
+package aferoguestfs_test
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenRegistryNotAHive(t *testing.T) {
+	clear(t, gfs)
+
+	err := afero.WriteFile(gfs, "SOFTWARE", []byte("some text"), os.ModePerm)
+	require.Nil(t, err)
+
+	_, err = gfs.OpenRegistry("SOFTWARE", false)
+	assert.NotNil(t, err)
+}
+
+// newHive returns a minimal registry hive with an empty root key, laid out
+// like the minimal hive shipped with hivex.
+func newHive() []byte {
+	const (
+		blockSize = 0x1000
+		nkOffset  = 0x20
+		nkSize    = 0x58
+		skOffset  = nkOffset + nkSize
+		skSize    = 0x30
+		freeStart = skOffset + skSize
+	)
+
+	hive := make([]byte, 2*blockSize)
+	le := binary.LittleEndian
+
+	// base block
+	copy(hive, "regf")
+	le.PutUint32(hive[0x04:], 1) // sequence numbers
+	le.PutUint32(hive[0x08:], 1)
+	le.PutUint32(hive[0x14:], 1) // version 1.3
+	le.PutUint32(hive[0x18:], 3)
+	le.PutUint32(hive[0x20:], 1) // file format
+	le.PutUint32(hive[0x24:], nkOffset)
+	le.PutUint32(hive[0x28:], blockSize)
+	le.PutUint32(hive[0x2c:], 1)
+	var sum uint32
+	for i := 0; i < 0x1fc; i += 4 {
+		sum ^= le.Uint32(hive[i:])
+	}
+	le.PutUint32(hive[0x1fc:], sum)
+
+	bin := hive[blockSize:]
+	copy(bin, "hbin")
+	le.PutUint32(bin[0x08:], blockSize)
+
+	// root key
+	nk := bin[nkOffset:]
+	le.PutUint32(nk, ^uint32(nkSize)+1) // allocated cells have negative sizes
+	copy(nk[0x04:], "nk")
+	le.PutUint16(nk[0x06:], 0x2c) // root, no delete, ASCII name
+	le.PutUint32(nk[0x14:], 0xffffffff)
+	le.PutUint32(nk[0x20:], 0xffffffff)
+	le.PutUint32(nk[0x24:], 0xffffffff)
+	le.PutUint32(nk[0x2c:], 0xffffffff)
+	le.PutUint32(nk[0x30:], skOffset)
+	le.PutUint32(nk[0x34:], 0xffffffff)
+	le.PutUint16(nk[0x4c:], 4)
+	copy(nk[0x50:], "ROOT")
+
+	// security descriptor shared by all keys
+	sk := bin[skOffset:]
+	le.PutUint32(sk, ^uint32(skSize)+1)
+	copy(sk[0x04:], "sk")
+	le.PutUint32(sk[0x08:], skOffset)
+	le.PutUint32(sk[0x0c:], skOffset)
+	le.PutUint32(sk[0x10:], 1)
+	le.PutUint32(sk[0x14:], 20)
+	sk[0x18] = 1                    // revision
+	le.PutUint16(sk[0x1a:], 0x8004) // self-relative, DACL present
+
+	le.PutUint32(bin[freeStart:], blockSize-freeStart)
+
+	return hive
+}
+
+func TestRegistryRoundTrip(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, afero.WriteFile(gfs, "SOFTWARE", newHive(), 0644))
+
+	reg, err := gfs.OpenRegistry("SOFTWARE", true)
+	require.Nil(t, err)
+
+	k, err := reg.CreateKey(`Microsoft\Windows NT\CurrentVersion`)
+	require.Nil(t, err)
+	require.Nil(t, k.SetString("ProductName", "Windows 10 Pro"))
+	require.Nil(t, k.SetDword("CurrentMajorVersionNumber", 10))
+	require.Nil(t, k.SetMultiString("Features", []string{"a", "b"}))
+
+	require.Nil(t, reg.Commit())
+	require.Nil(t, reg.Close())
+
+	reg, err = gfs.OpenRegistry("SOFTWARE", false)
+	require.Nil(t, err)
+	defer reg.Close()
+
+	k, err = reg.Key("microsoft/windows nt/currentversion")
+	require.Nil(t, err)
+
+	s, err := k.GetString("ProductName")
+	assert.Nil(t, err)
+	assert.Equal(t, "Windows 10 Pro", s)
+
+	d, err := k.GetDword("CurrentMajorVersionNumber")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(10), d)
+
+	ss, err := k.GetMultiString("Features")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, ss)
+}
+
+func TestValueString(t *testing.T) {
+	v := aferoguestfs.Value{
+		Name: "ProductName",
+		Type: aferoguestfs.RegSz,
+		Data: []byte{'W', 0, 'i', 0, 'n', 0, 0, 0},
+	}
+
+	s, err := v.StringValue()
+	assert.Nil(t, err)
+	assert.Equal(t, "Win", s)
+
+	_, err = v.Dword()
+	assert.NotNil(t, err)
+}
+
+func TestValueDword(t *testing.T) {
+	v := aferoguestfs.Value{
+		Name: "Start",
+		Type: aferoguestfs.RegDword,
+		Data: []byte{0x02, 0x01, 0x00, 0x00},
+	}
+
+	d, err := v.Dword()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0x0102), d)
+
+	v.Type = aferoguestfs.RegDwordBigEndian
+	d, err = v.Dword()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0x02010000), d)
+}
+
+func TestValueMultiString(t *testing.T) {
+	v := aferoguestfs.Value{
+		Name: "DependOnService",
+		Type: aferoguestfs.RegMultiSz,
+		Data: []byte{'a', 0, 0, 0, 'b', 0, 'c', 0, 0, 0, 0, 0},
+	}
+
+	ss, err := v.MultiString()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "bc"}, ss)
+}
@@ -0,0 +1,257 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// gptEntriesSize is the size in bytes of the 128 partition entries of a GPT.
+const gptEntriesSize = 16384
+
+// gptBackupSectors returns the number of sectors at the end of a disk with
+// sectorSize byte sectors taken by the backup GPT header and partition
+// entries.
+func gptBackupSectors(sectorSize int) int64 {
+	return gptEntriesSize/int64(sectorSize) + 1
+}
+
+// Resize grows a raw disk image to size bytes, extends partition to fill the
+// new space and grows the filesystem on it.
+//
+// The partition must be the last one on the disk. The filesystem tool is
+// picked based on the filesystem type: resize2fs for ext2/3/4, xfs_growfs for
+// xfs, btrfs filesystem resize for btrfs and ntfsresize for ntfs.
+func Resize(image string, partition string, size int64) error {
+	fi, err := os.Stat(image)
+	if err != nil {
+		return fmt.Errorf("stat image failed: %w", err)
+	}
+
+	if size < fi.Size() {
+		return fmt.Errorf("cannot shrink image from %d to %d bytes", fi.Size(), size)
+	}
+
+	// check the layout before touching the image so that a failed resize
+	// leaves it unchanged
+	if err := checkResizable(image, partition); err != nil {
+		return err
+	}
+
+	if err := os.Truncate(image, size); err != nil {
+		return fmt.Errorf("truncate image failed: %w", err)
+	}
+
+	g, err := launchResize(image, false)
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	if err := growPartition(g, partition); err != nil {
+		return err
+	}
+
+	if err := growFilesystem(g, partition); err != nil {
+		return err
+	}
+
+	if err := g.Shutdown(); err != nil {
+		return fmt.Errorf("shutdown failed: %w", err)
+	}
+
+	return nil
+}
+
+// checkResizable returns an error if partition can't be grown by Resize.
+func checkResizable(image string, partition string) error {
+	g, err := launchResize(image, true)
+	if err != nil {
+		return err
+	}
+	defer g.Close()
+
+	device, err := g.Part_to_dev(partition)
+	if err != nil {
+		return fmt.Errorf("failed to get device of %s: %w", partition, err)
+	}
+
+	partnum, err := g.Part_to_partnum(partition)
+	if err != nil {
+		return fmt.Errorf("failed to get partition number of %s: %w", partition, err)
+	}
+
+	parts, err := g.Part_list(device)
+	if err != nil {
+		return fmt.Errorf("failed to list partitions on %s: %w", device, err)
+	}
+
+	if !isLastPartition(*parts, partnum) {
+		return fmt.Errorf("partition %s is not the last partition on %s", partition, device)
+	}
+
+	vfsType, err := g.Vfs_type(partition)
+	if err != nil {
+		return fmt.Errorf("failed to get filesystem type of %s: %w", partition, err)
+	}
+
+	switch vfsType {
+	case "ext2", "ext3", "ext4", "xfs", "btrfs", "ntfs":
+	default:
+		return fmt.Errorf("resizing %s filesystems is not supported", vfsType)
+	}
+
+	return nil
+}
+
+// launchResize launches a guestfs handle with image as its only drive.
+func launchResize(image string, readOnly bool) (*guestfs.Guestfs, error) {
+	g, err := guestfs.Create()
+	if err != nil {
+		return nil, fmt.Errorf("create failed: %w", err)
+	}
+
+	if err := g.Add_drive(image, &guestfs.OptargsAdd_drive{
+		Format_is_set:   true,
+		Format:          "raw",
+		Readonly_is_set: readOnly,
+		Readonly:        readOnly,
+	}); err != nil {
+		g.Close()
+		return nil, fmt.Errorf("add drive failed: %w", err)
+	}
+
+	if err := g.Launch(); err != nil {
+		g.Close()
+		return nil, fmt.Errorf("launch failed: %w", err)
+	}
+
+	return g, nil
+}
+
+// growPartition moves the end of partition to the last usable sector of its
+// device.
+func growPartition(g *guestfs.Guestfs, partition string) error {
+	device, err := g.Part_to_dev(partition)
+	if err != nil {
+		return fmt.Errorf("failed to get device of %s: %w", partition, err)
+	}
+
+	partnum, err := g.Part_to_partnum(partition)
+	if err != nil {
+		return fmt.Errorf("failed to get partition number of %s: %w", partition, err)
+	}
+
+	parttype, err := g.Part_get_parttype(device)
+	if err != nil {
+		return fmt.Errorf("failed to get partition table type of %s: %w", device, err)
+	}
+
+	if parttype == "gpt" {
+		// move the backup GPT header to the new end of the disk
+		if err := g.Part_expand_gpt(device); err != nil {
+			return fmt.Errorf("failed to expand gpt on %s: %w", device, err)
+		}
+	}
+
+	parts, err := g.Part_list(device)
+	if err != nil {
+		return fmt.Errorf("failed to list partitions on %s: %w", device, err)
+	}
+
+	if !isLastPartition(*parts, partnum) {
+		return fmt.Errorf("partition %s is not the last partition on %s", partition, device)
+	}
+
+	sectorSize, err := g.Blockdev_getss(device)
+	if err != nil {
+		return fmt.Errorf("failed to get sector size of %s: %w", device, err)
+	}
+
+	deviceSize, err := g.Blockdev_getsize64(device)
+	if err != nil {
+		return fmt.Errorf("failed to get size of %s: %w", device, err)
+	}
+
+	endsect := deviceSize/int64(sectorSize) - 1
+	if parttype == "gpt" {
+		endsect -= gptBackupSectors(sectorSize)
+	}
+
+	if err := g.Part_resize(device, partnum, endsect); err != nil {
+		return fmt.Errorf("failed to resize partition %s: %w", partition, err)
+	}
+
+	return nil
+}
+
+func isLastPartition(parts []guestfs.Partition, partnum int) bool {
+	var start uint64
+	for _, p := range parts {
+		if p.Part_num == int32(partnum) {
+			start = p.Part_start
+		}
+	}
+
+	for _, p := range parts {
+		if p.Part_num != int32(partnum) && p.Part_start > start {
+			return false
+		}
+	}
+
+	return true
+}
+
+// growFilesystem grows the filesystem on partition to fill the partition.
+func growFilesystem(g *guestfs.Guestfs, partition string) error {
+	vfsType, err := g.Vfs_type(partition)
+	if err != nil {
+		return fmt.Errorf("failed to get filesystem type of %s: %w", partition, err)
+	}
+
+	switch vfsType {
+	case "ext2", "ext3", "ext4":
+		if err := g.E2fsck_f(partition); err != nil {
+			return fmt.Errorf("e2fsck failed on %s: %w", partition, err)
+		}
+		if err := g.Resize2fs(partition); err != nil {
+			return fmt.Errorf("resize2fs failed on %s: %w", partition, err)
+		}
+	case "xfs":
+		if err := withMount(g, partition, func(mountpoint string) error {
+			return g.Xfs_growfs(mountpoint, nil)
+		}); err != nil {
+			return fmt.Errorf("xfs_growfs failed on %s: %w", partition, err)
+		}
+	case "btrfs":
+		if err := withMount(g, partition, func(mountpoint string) error {
+			return g.Btrfs_filesystem_resize(mountpoint, nil)
+		}); err != nil {
+			return fmt.Errorf("btrfs filesystem resize failed on %s: %w", partition, err)
+		}
+	case "ntfs":
+		if err := g.Ntfsresize(partition, nil); err != nil {
+			return fmt.Errorf("ntfsresize failed on %s: %w", partition, err)
+		}
+	default:
+		return fmt.Errorf("resizing %s filesystems is not supported", vfsType)
+	}
+
+	return nil
+}
+
+// withMount mounts partition at the appliance root, calls fn and unmounts it.
+func withMount(g *guestfs.Guestfs, partition string, fn func(mountpoint string) error) error {
+	if err := g.Mount(partition, "/"); err != nil {
+		return err
+	}
+
+	fnErr := fn("/")
+
+	if err := g.Umount("/", nil); err != nil && fnErr == nil {
+		return err
+	}
+
+	return fnErr
+}
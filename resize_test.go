@@ -0,0 +1,78 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResize(t *testing.T) {
+	image := newTest1Image(t)
+
+	g, gClose, err := newGuestFs(image, "/dev/sda2")
+	require.Nil(t, err)
+	before, err := g.Statvfs("/")
+	require.Nil(t, err)
+	require.Nil(t, gClose())
+
+	err = aferoguestfs.Resize(image, "/dev/sda2", 4*1024*1024)
+	assert.Nil(t, err)
+
+	fi, err := os.Stat(image)
+	require.Nil(t, err)
+	assert.Equal(t, int64(4*1024*1024), fi.Size())
+
+	g, gClose, err = newGuestFs(image, "/dev/sda2")
+	require.Nil(t, err)
+	after, err := g.Statvfs("/")
+	require.Nil(t, err)
+	require.Nil(t, gClose())
+
+	assert.Greater(t, after.Blocks*after.Bsize, before.Blocks*before.Bsize)
+}
+
+func TestResizeShrink(t *testing.T) {
+	image := newTest1Image(t)
+
+	err := aferoguestfs.Resize(image, "/dev/sda2", 1024*1024)
+	assert.NotNil(t, err)
+}
+
+func TestResizeNotLastPartition(t *testing.T) {
+	image := newTest1Image(t)
+
+	err := aferoguestfs.Resize(image, "/dev/sda1", 4*1024*1024)
+	assert.NotNil(t, err)
+
+	// the image must be left untouched
+	fi, err := os.Stat(image)
+	require.Nil(t, err)
+	assert.Equal(t, int64(len(test1Img)), fi.Size())
+}
+
+func TestResizeGPT(t *testing.T) {
+	image := newImage(t, 32*1024*1024, func(g *guestfs.Guestfs) error {
+		if err := g.Part_disk("/dev/sda", "gpt"); err != nil {
+			return err
+		}
+		return g.Mkfs("ext4", "/dev/sda1", nil)
+	})
+
+	require.Nil(t, aferoguestfs.Resize(image, "/dev/sda1", 64*1024*1024))
+
+	fsys, err := aferoguestfs.OpenPartitionFs(image, "/dev/sda1")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	part, err := fsys.Disk.Partition(1)
+	require.Nil(t, err)
+
+	// the partition ends right before the backup GPT
+	ss, err := fsys.Disk.SectorSize()
+	require.Nil(t, err)
+	assert.Equal(t, uint64(64*1024*1024-(16384+ss)-1), part.End)
+}
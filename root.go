@@ -0,0 +1,256 @@
+package aferoguestfs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// RootFs is an afero.Fs confined to a directory of an Fs. Paths are relative
+// to the directory and symlinks are resolved with the directory as their
+// root, so no operation can reach files outside of it, like with os.Root.
+type RootFs struct {
+	fs   *Fs
+	root string
+}
+
+// OpenRoot returns a RootFs confined to the directory dir.
+func (fs *Fs) OpenRoot(dir string) (*RootFs, error) {
+	dir, err := fs.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := fs.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "openroot", Path: dir, Err: errors.New("not a directory")}
+	}
+
+	return &RootFs{fs: fs, root: dir}, nil
+}
+
+// OpenInRoot opens name in the directory dir without escaping it through
+// symlinks.
+func (fs *Fs) OpenInRoot(dir string, name string) (afero.File, error) {
+	r, err := fs.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return r.Open(name)
+}
+
+// resolve returns the path of name in the underlying Fs.
+func (r *RootFs) resolve(name string, followLast bool) (string, error) {
+	return r.fs.resolveIn(r.root, name, followLast)
+}
+
+// Chmod implements afero.Fs.
+func (r *RootFs) Chmod(name string, mode os.FileMode) error {
+	p, err := r.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	return r.fs.Chmod(p, mode)
+}
+
+// Chown implements afero.Fs.
+func (r *RootFs) Chown(name string, uid int, gid int) error {
+	p, err := r.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	return r.fs.Chown(p, uid, gid)
+}
+
+// Lchown is the analogue of os.Lchown.
+func (r *RootFs) Lchown(name string, uid int, gid int) error {
+	p, err := r.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Lchown(p, uid, gid)
+}
+
+// Chtimes implements afero.Fs.
+func (r *RootFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	p, err := r.resolve(name, true)
+	if err != nil {
+		return err
+	}
+	return r.fs.Chtimes(p, atime, mtime)
+}
+
+// Create implements afero.Fs.
+func (r *RootFs) Create(name string) (afero.File, error) {
+	return r.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Mkdir implements afero.Fs.
+func (r *RootFs) Mkdir(name string, perm os.FileMode) error {
+	p, err := r.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Mkdir(p, perm)
+}
+
+// MkdirAll implements afero.Fs. Every component is resolved before it is
+// created, so symlinks on the way are followed inside the root.
+func (r *RootFs) MkdirAll(name string, perm os.FileMode) error {
+	prefix := ""
+	for _, c := range splitPath(name) {
+		prefix = path.Join(prefix, c)
+
+		p, err := r.resolve(prefix, true)
+		if err != nil {
+			return err
+		}
+
+		info, err := r.fs.Stat(p)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			if err := r.fs.Mkdir(p, perm); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case !info.IsDir():
+			return &os.PathError{Op: "mkdir", Path: name, Err: errors.New("not a directory")}
+		}
+	}
+	return nil
+}
+
+// Name implements afero.Fs.
+func (r *RootFs) Name() string {
+	return "guestfs root " + r.root
+}
+
+// Open implements afero.Fs.
+func (r *RootFs) Open(name string) (afero.File, error) {
+	return r.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile implements afero.Fs.
+func (r *RootFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	p, err := r.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := r.fs.OpenFile(p, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rootFile{File: f, fs: r.fs, name: name, path: p}, nil
+}
+
+// Remove implements afero.Fs.
+func (r *RootFs) Remove(name string) error {
+	p, err := r.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Remove(p)
+}
+
+// RemoveAll implements afero.Fs. Symlinks below name are removed, not
+// followed.
+func (r *RootFs) RemoveAll(name string) error {
+	p, err := r.resolve(name, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.RemoveAll(p)
+}
+
+// Rename implements afero.Fs.
+func (r *RootFs) Rename(oldname string, newname string) error {
+	oldPath, err := r.resolve(oldname, false)
+	if err != nil {
+		return err
+	}
+	newPath, err := r.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Rename(oldPath, newPath)
+}
+
+// Stat implements afero.Fs.
+func (r *RootFs) Stat(name string) (os.FileInfo, error) {
+	p, err := r.resolve(name, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.fs.Stat(p)
+}
+
+// LstatIfPossible implements afero.Lstater.
+func (r *RootFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	p, err := r.resolve(name, false)
+	if err != nil {
+		return nil, true, err
+	}
+	fi, err := r.fs.Lstat(p)
+	return fi, true, err
+}
+
+// ReadlinkIfPossible implements afero.LinkReader.
+func (r *RootFs) ReadlinkIfPossible(name string) (string, error) {
+	p, err := r.resolve(name, false)
+	if err != nil {
+		return "", err
+	}
+	return r.fs.Readlink(p)
+}
+
+// SymlinkIfPossible implements afero.Linker. The target is stored as is and
+// resolved inside the root when followed.
+func (r *RootFs) SymlinkIfPossible(oldname string, newname string) error {
+	p, err := r.resolve(newname, false)
+	if err != nil {
+		return err
+	}
+	return r.fs.Symlink(oldname, p)
+}
+
+// rootFile is a file opened through a RootFs.
+type rootFile struct {
+	afero.File
+	fs *Fs
+
+	// name is the name the file was opened with, path its resolved path
+	name string
+	path string
+}
+
+// Name implements afero.File.
+func (f *rootFile) Name() string {
+	return f.name
+}
+
+// Readdir implements afero.File. Entries are lstat'ed, so the infos of
+// symlinks pointing outside of the root aren't revealed.
+func (f *rootFile) Readdir(count int) ([]os.FileInfo, error) {
+	entries, err := f.fs.readDirBatch(f.path, false)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+
+	ret := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		ret = append(ret, e.info)
+	}
+	return ret, nil
+}
@@ -0,0 +1,54 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenRoot(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.MkdirAll("/jail/etc", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "/secret.txt", []byte("outside"), 0644))
+	require.Nil(t, afero.WriteFile(gfs, "/jail/secret.txt", []byte("inside"), 0644))
+	require.Nil(t, gfs.Symlink("/secret.txt", "/jail/etc/abs"))
+	require.Nil(t, gfs.Symlink("../../../secret.txt", "/jail/etc/rel"))
+	require.Nil(t, gfs.Symlink("/new", "/jail/dangling"))
+
+	root, err := gfs.OpenRoot("/jail")
+	require.Nil(t, err)
+
+	for _, name := range []string{"/etc/abs", "etc/rel", "../secret.txt"} {
+		bs, err := afero.ReadFile(root, name)
+		require.Nil(t, err, name)
+		assert.Equal(t, "inside", string(bs), name)
+	}
+
+	require.Nil(t, afero.WriteFile(root, "/dangling", []byte("created"), 0644))
+	bs, err := afero.ReadFile(gfs, "/jail/new")
+	require.Nil(t, err)
+	assert.Equal(t, "created", string(bs))
+
+	require.Nil(t, root.MkdirAll("/a/b", 0755))
+	info, err := gfs.Stat("/jail/a/b")
+	require.Nil(t, err)
+	assert.True(t, info.IsDir())
+
+	infos, err := afero.ReadDir(root, "/etc")
+	require.Nil(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, os.ModeSymlink, infos[0].Mode().Type())
+
+	require.Nil(t, root.Remove("/etc/abs"))
+	_, err = gfs.Stat("/secret.txt")
+	assert.Nil(t, err)
+
+	f, err := gfs.OpenInRoot("/jail", "etc/rel")
+	require.Nil(t, err)
+	assert.Equal(t, "etc/rel", f.Name())
+	require.Nil(t, f.Close())
+}
@@ -0,0 +1,290 @@
+package aferoguestfs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// rsyncHostAddr is the address of the host as seen from the appliance's user
+// mode network (slirp or passt), the only network libguestfs sets up.
+// Connections to it reach the host's loopback interface.
+const rsyncHostAddr = "10.0.2.2"
+
+// RsyncOptions configure RsyncIn and RsyncOut.
+type RsyncOptions struct {
+	// Archive preserves symlinks, permissions, ownership and times, like
+	// rsync -a.
+	Archive bool
+
+	// Delete removes files in the destination that don't exist in the
+	// source.
+	Delete bool
+}
+
+// RsyncIn synchronizes dir in the guest with the contents of hostDir using
+// rsync's delta transfer. It serves hostDir with an rsync daemon on the host's
+// loopback interface under a random, unlisted module name that only the
+// appliance is told, so rsync must be installed on the host and in the
+// appliance, and the appliance network must be enabled, e.g. with
+// OpenNetworkPartitionFs.
+func (fs *Fs) RsyncIn(hostDir string, dir string, opts *RsyncOptions) error {
+	if opts == nil {
+		opts = &RsyncOptions{}
+	}
+
+	dir = fs.resolvePath(dir)
+	if err := fs.checkNetwork(); err != nil {
+		return err
+	}
+
+	d, err := startRsyncDaemon(hostDir, true)
+	if err != nil {
+		return err
+	}
+	defer d.stop()
+
+	fs.invalidateAll()
+	err = fs.guestfs.Rsync_in(d.url(), dir, &guestfs.OptargsRsync_in{
+		Archive_is_set:    true,
+		Archive:           opts.Archive,
+		Deletedest_is_set: true,
+		Deletedest:        opts.Delete,
+	})
+	if err != nil {
+		return fmt.Errorf("rsync in failed: %w", d.withLog(wrapErr(err, dir)))
+	}
+
+	return nil
+}
+
+// RsyncOut synchronizes hostDir with the contents of dir in the guest. See
+// RsyncIn for its requirements.
+func (fs *Fs) RsyncOut(dir string, hostDir string, opts *RsyncOptions) error {
+	if opts == nil {
+		opts = &RsyncOptions{}
+	}
+
+	dir = fs.resolvePath(dir)
+	if err := fs.checkNetwork(); err != nil {
+		return err
+	}
+
+	d, err := startRsyncDaemon(hostDir, false)
+	if err != nil {
+		return err
+	}
+	defer d.stop()
+
+	// the trailing slash copies the contents of dir rather than dir itself
+	err = fs.guestfs.Rsync_out(strings.TrimSuffix(dir, "/")+"/", d.url(), &guestfs.OptargsRsync_out{
+		Archive_is_set:    true,
+		Archive:           opts.Archive,
+		Deletedest_is_set: true,
+		Deletedest:        opts.Delete,
+	})
+	if err != nil {
+		return fmt.Errorf("rsync out failed: %w", d.withLog(wrapErr(err, dir)))
+	}
+
+	return nil
+}
+
+func (fs *Fs) checkNetwork() error {
+	network, err := fs.guestfs.Get_network()
+	if err != nil {
+		return fmt.Errorf("failed to get network: %w", err)
+	}
+	if !network {
+		return fmt.Errorf("appliance network is disabled")
+	}
+	return nil
+}
+
+// rsyncDaemon serves a host directory to the appliance. It listens on a
+// loopback port itself and runs rsync --daemon in inetd mode for every
+// connection, so no other process can take the port between picking and
+// binding it.
+//
+// The appliance's rsync can only be given a daemon password through its
+// environment, which the guestfs API doesn't expose, so the module name is a
+// one-time secret instead.
+type rsyncDaemon struct {
+	rsync    string
+	tmpDir   string
+	module   string
+	listener net.Listener
+
+	mu    sync.Mutex
+	procs map[*exec.Cmd]bool
+	wg    sync.WaitGroup
+}
+
+// startRsyncDaemon serves dir on a free loopback port.
+func startRsyncDaemon(dir string, readOnly bool) (*rsyncDaemon, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rsync, err := exec.LookPath("rsync")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find rsync: %w", err)
+	}
+
+	module, err := randomModule()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "afero-guestfs-rsyncd-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tmp dir: %w", err)
+	}
+
+	config := filepath.Join(tmpDir, "rsyncd.conf")
+	if err := os.WriteFile(config, []byte(rsyncConfig(dir, readOnly, module)), 0600); err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("failed to write rsync config: %w", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+
+	d := &rsyncDaemon{
+		rsync:    rsync,
+		tmpDir:   tmpDir,
+		module:   module,
+		listener: l,
+		procs:    map[*exec.Cmd]bool{},
+	}
+
+	d.wg.Add(1)
+	go d.serve()
+
+	return d, nil
+}
+
+func (d *rsyncDaemon) serve() {
+	defer d.wg.Done()
+
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			// closed by stop
+			return
+		}
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer conn.Close()
+			d.handle(conn.(*net.TCPConn))
+		}()
+	}
+}
+
+// handle runs rsync --daemon with conn as its stdin and stdout, which makes
+// it serve the connection in inetd mode.
+func (d *rsyncDaemon) handle(conn *net.TCPConn) {
+	f, err := conn.File()
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	cmd := exec.Command(d.rsync, "--daemon",
+		"--config="+filepath.Join(d.tmpDir, "rsyncd.conf"),
+		"--log-file="+d.logFile())
+	cmd.Stdin = f
+	cmd.Stdout = f
+
+	d.mu.Lock()
+	if d.procs == nil {
+		// stopped
+		d.mu.Unlock()
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		d.mu.Unlock()
+		return
+	}
+	d.procs[cmd] = true
+	d.mu.Unlock()
+
+	cmd.Wait()
+
+	d.mu.Lock()
+	delete(d.procs, cmd)
+	d.mu.Unlock()
+}
+
+// url is the rsync URL of the served directory's contents for the appliance.
+func (d *rsyncDaemon) url() string {
+	port := d.listener.Addr().(*net.TCPAddr).Port
+	return fmt.Sprintf("rsync://%s:%d/%s/", rsyncHostAddr, port, d.module)
+}
+
+func (d *rsyncDaemon) logFile() string {
+	return filepath.Join(d.tmpDir, "rsyncd.log")
+}
+
+// withLog adds the daemon's log to err.
+func (d *rsyncDaemon) withLog(err error) error {
+	log, _ := os.ReadFile(d.logFile())
+	log = bytes.TrimSpace(log)
+	if len(log) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w\nrsync daemon log:\n%s", err, log)
+}
+
+func (d *rsyncDaemon) stop() {
+	d.listener.Close()
+
+	d.mu.Lock()
+	for cmd := range d.procs {
+		cmd.Process.Kill()
+	}
+	d.procs = nil
+	d.mu.Unlock()
+
+	d.wg.Wait()
+	os.RemoveAll(d.tmpDir)
+}
+
+// rsyncConfig returns an rsyncd.conf serving dir as the unlisted module with
+// the permissions of the current user.
+func rsyncConfig(dir string, readOnly bool, module string) string {
+	return fmt.Sprintf(`use chroot = no
+munge symlinks = no
+uid = %d
+gid = %d
+
+[%s]
+path = %s
+read only = %t
+list = no
+`, os.Getuid(), os.Getgid(), module, dir, readOnly)
+}
+
+// randomModule returns a random one-time module name for the rsync daemon.
+func randomModule() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate module name: %w", err)
+	}
+	return "afero-" + hex.EncodeToString(b), nil
+}
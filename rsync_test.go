@@ -0,0 +1,51 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRsync(t *testing.T) {
+	if _, err := exec.LookPath("rsync"); err != nil {
+		t.Skip("rsync not installed")
+	}
+
+	fsys, err := aferoguestfs.OpenNetworkPartitionFs(newTest1Image(t), "/dev/sda2")
+	require.Nil(t, err)
+	defer fsys.Close()
+
+	in := t.TempDir()
+	require.Nil(t, os.Mkdir(filepath.Join(in, "dir"), 0755))
+	require.Nil(t, os.WriteFile(filepath.Join(in, "dir", "test.txt"), []byte("some text"), 0644))
+
+	require.Nil(t, fsys.RsyncIn(in, "/rsync", &aferoguestfs.RsyncOptions{Archive: true}))
+
+	bs, err := afero.ReadFile(fsys, "/rsync/dir/test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(bs))
+
+	require.Nil(t, afero.WriteFile(fsys, "/rsync/dir/test.txt", []byte("other text"), 0644))
+
+	out := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(out, "extra.txt"), []byte("extra"), 0644))
+	require.Nil(t, fsys.RsyncOut("/rsync", out, &aferoguestfs.RsyncOptions{Archive: true, Delete: true}))
+
+	bs, err = os.ReadFile(filepath.Join(out, "dir", "test.txt"))
+	require.Nil(t, err)
+	assert.Equal(t, "other text", string(bs))
+
+	_, err = os.Stat(filepath.Join(out, "extra.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRsyncNetworkDisabled(t *testing.T) {
+	err := gfs.RsyncIn(t.TempDir(), "/rsync", nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,384 @@
+package aferoguestfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+	"github.com/spf13/afero"
+)
+
+// SyncOptions configure Sync.
+type SyncOptions struct {
+	// Delete removes files in the destination that don't exist in the
+	// source.
+	Delete bool
+
+	// Checksum compares the SHA-256 checksums of regular files with the same
+	// size and modification time instead of assuming they are unchanged.
+	Checksum bool
+
+	// Owner copies the owner and group of files. The source must report
+	// them through a FileInfo with Uid and Gid methods or a *syscall.Stat_t.
+	Owner bool
+}
+
+// SyncSummary lists the paths changed by Sync, relative to the destination
+// directory.
+type SyncSummary struct {
+	Created   []string
+	Updated   []string
+	Deleted   []string
+	Unchanged int
+}
+
+// Sync makes dstDir in dst a copy of srcDir in src. Only files whose size,
+// modification time, mode or owner differ are written. Symlinks are copied
+// as symlinks and files hardlinked in the source are hardlinked in the
+// destination.
+func Sync(src afero.Fs, srcDir string, dst *Fs, dstDir string, opts *SyncOptions) (*SyncSummary, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+
+	dstDir = dst.resolvePath(dstDir)
+	if err := dst.MkdirAll(dstDir, 0755); err != nil {
+		return nil, err
+	}
+
+	existing, err := dst.collectTree(dstDir, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk destination: %w", err)
+	}
+
+	s := &syncer{
+		src:      src,
+		dst:      dst,
+		dstDir:   dstDir,
+		opts:     opts,
+		existing: existing,
+		seen:     map[string]bool{},
+		links:    map[uint64]string{},
+		summary:  &SyncSummary{},
+	}
+
+	err = afero.Walk(src, srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		return s.sync(path, rel, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Delete {
+		if err := s.deleteExtraneous(); err != nil {
+			return nil, err
+		}
+	}
+
+	// directory times change while their children are written, so set them
+	// last, children first
+	for i := len(s.dirTimes) - 1; i >= 0; i-- {
+		dt := s.dirTimes[i]
+		if err := dst.Chtimes(dt.path, dt.mtime, dt.mtime); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.summary, nil
+}
+
+type syncer struct {
+	src      afero.Fs
+	dst      *Fs
+	dstDir   string
+	opts     *SyncOptions
+	existing map[string]*treeEntry
+
+	// seen are the relative paths present in the source
+	seen map[string]bool
+	// links maps inodes of hardlinked source files to their first
+	// destination path
+	links map[uint64]string
+
+	dirTimes []dirTime
+	summary  *SyncSummary
+}
+
+type dirTime struct {
+	path  string
+	mtime time.Time
+}
+
+func (s *syncer) sync(srcPath string, rel string, info os.FileInfo) error {
+	s.seen[rel] = true
+	dstPath := filepath.Join(s.dstDir, rel)
+	cur := s.existing[rel]
+
+	if cur != nil && cur.info.Mode().Type() != info.Mode().Type() {
+		if err := s.dst.RemoveAll(dstPath); err != nil {
+			return err
+		}
+		s.forget(rel)
+		cur = nil
+	}
+
+	var changed bool
+	var err error
+	switch {
+	case info.IsDir():
+		changed, err = s.syncDir(dstPath, cur, info)
+	case info.Mode()&os.ModeSymlink != 0:
+		changed, err = s.syncSymlink(srcPath, dstPath, cur)
+	case info.Mode().IsRegular():
+		changed, err = s.syncFile(srcPath, dstPath, cur, info)
+	default:
+		// devices, fifos and sockets can't be created through Fs
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink == 0 && (cur == nil || cur.info.Mode() != info.Mode()) {
+		if err := s.dst.Chmod(dstPath, info.Mode()); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if s.opts.Owner {
+		if uid, gid, ok := fileOwner(info); ok && (cur == nil || cur.info.Uid() != uid || cur.info.Gid() != gid) {
+			if err := s.dst.Lchown(dstPath, uid, gid); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	switch {
+	case cur == nil:
+		s.summary.Created = append(s.summary.Created, rel)
+	case changed:
+		s.summary.Updated = append(s.summary.Updated, rel)
+	default:
+		s.summary.Unchanged++
+	}
+
+	return nil
+}
+
+func (s *syncer) syncDir(dstPath string, cur *treeEntry, info os.FileInfo) (bool, error) {
+	changed := false
+	if cur == nil {
+		if err := s.dst.Mkdir(dstPath, info.Mode()); err != nil {
+			return false, err
+		}
+		changed = true
+	} else if cur.info.ModTime().Unix() != info.ModTime().Unix() {
+		changed = true
+	}
+
+	s.dirTimes = append(s.dirTimes, dirTime{path: dstPath, mtime: info.ModTime()})
+	return changed, nil
+}
+
+func (s *syncer) syncSymlink(srcPath string, dstPath string, cur *treeEntry) (bool, error) {
+	reader, ok := s.src.(afero.LinkReader)
+	if !ok {
+		return false, fmt.Errorf("source filesystem %s can't read symlinks", s.src.Name())
+	}
+
+	target, err := reader.ReadlinkIfPossible(srcPath)
+	if err != nil {
+		return false, err
+	}
+
+	if cur != nil && cur.target == target {
+		return false, nil
+	}
+
+	if cur != nil {
+		if err := s.dst.Remove(dstPath); err != nil {
+			return false, err
+		}
+	}
+
+	return true, s.dst.Symlink(target, dstPath)
+}
+
+func (s *syncer) syncFile(srcPath string, dstPath string, cur *treeEntry, info os.FileInfo) (bool, error) {
+	if ino, ok := fileHardlinkIno(info); ok {
+		if first, ok := s.links[ino]; ok {
+			return s.syncHardlink(first, dstPath, cur)
+		}
+		s.links[ino] = dstPath
+	}
+
+	if cur != nil && cur.info.Size() == info.Size() && cur.info.ModTime().Unix() == info.ModTime().Unix() {
+		if !s.opts.Checksum {
+			return false, nil
+		}
+
+		same, err := s.sameContent(srcPath, dstPath)
+		if err != nil || same {
+			return false, err
+		}
+	}
+
+	data, err := afero.ReadFile(s.src, srcPath)
+	if err != nil {
+		return false, err
+	}
+
+	if cur != nil && cur.info.stat.St_nlink > 1 {
+		// don't write through a hardlink that isn't in the source
+		if err := s.dst.Remove(dstPath); err != nil {
+			return false, err
+		}
+	}
+
+	if err := afero.WriteFile(s.dst, dstPath, data, info.Mode().Perm()); err != nil {
+		return false, err
+	}
+
+	if err := s.dst.Chtimes(dstPath, info.ModTime(), info.ModTime()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// syncHardlink makes dstPath a hardlink of first, the destination of an
+// earlier path of the same source inode.
+func (s *syncer) syncHardlink(first string, dstPath string, cur *treeEntry) (bool, error) {
+	firstInfo, err := s.dst.Lstat(first)
+	if err != nil {
+		return false, err
+	}
+
+	if cur != nil && cur.info.Ino() == firstInfo.(*fileInfo).Ino() {
+		return false, nil
+	}
+
+	if cur != nil {
+		if err := s.dst.Remove(dstPath); err != nil {
+			return false, err
+		}
+	}
+
+	return true, s.dst.Link(first, dstPath)
+}
+
+func (s *syncer) sameContent(srcPath string, dstPath string) (bool, error) {
+	f, err := s.src.Open(srcPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+
+	dstDigest, err := s.dst.Checksum(SHA256, dstPath)
+	if err != nil {
+		return false, err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)) == dstDigest, nil
+}
+
+// deleteExtraneous removes destination files that aren't in the source.
+func (s *syncer) deleteExtraneous() error {
+	var extraneous []string
+	for rel := range s.existing {
+		if !s.seen[rel] {
+			extraneous = append(extraneous, rel)
+		}
+	}
+	sort.Strings(extraneous)
+
+	removed := map[string]bool{}
+	for _, rel := range extraneous {
+		// children of a removed directory are already gone
+		if hasRemovedParent(rel, removed) {
+			continue
+		}
+
+		if err := s.dst.RemoveAll(filepath.Join(s.dstDir, rel)); err != nil {
+			return err
+		}
+
+		s.summary.Deleted = append(s.summary.Deleted, rel)
+		removed[rel] = true
+	}
+
+	return nil
+}
+
+// hasRemovedParent reports whether a parent directory of rel is in removed.
+func hasRemovedParent(rel string, removed map[string]bool) bool {
+	for dir := filepath.Dir(rel); dir != "."; dir = filepath.Dir(dir) {
+		if removed[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// forget drops rel and its children from the existing destination files after
+// they were removed.
+func (s *syncer) forget(rel string) {
+	for p := range s.existing {
+		if p == rel || strings.HasPrefix(p, rel+"/") {
+			delete(s.existing, p)
+		}
+	}
+}
+
+// fileOwner returns the owner of a source file, if the source reports it.
+func fileOwner(info os.FileInfo) (uid int, gid int, ok bool) {
+	if o, ok := info.(interface {
+		Uid() int
+		Gid() int
+	}); ok {
+		return o.Uid(), o.Gid(), true
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(st.Uid), int(st.Gid), true
+	}
+	return 0, 0, false
+}
+
+// fileHardlinkIno returns the inode of a source file if it has more than one
+// link.
+func fileHardlinkIno(info os.FileInfo) (uint64, bool) {
+	switch st := info.Sys().(type) {
+	case *syscall.Stat_t:
+		return uint64(st.Ino), st.Nlink > 1
+	case *guestfs.StatNS:
+		return uint64(st.St_ino), st.St_nlink > 1
+	}
+	return 0, false
+}
@@ -0,0 +1,116 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSync(t *testing.T) {
+	clear(t, gfs)
+
+	src := t.TempDir()
+	require.Nil(t, os.Mkdir(filepath.Join(src, "dir"), 0750))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "dir", "a.txt"), []byte("some text"), 0644))
+	require.Nil(t, os.WriteFile(filepath.Join(src, "b.txt"), []byte("other text"), 0600))
+	require.Nil(t, os.Link(filepath.Join(src, "b.txt"), filepath.Join(src, "c.txt")))
+	require.Nil(t, os.Symlink("dir/a.txt", filepath.Join(src, "link")))
+
+	summary, err := aferoguestfs.Sync(afero.NewOsFs(), src, gfs, "/sync", nil)
+	require.Nil(t, err)
+	assert.ElementsMatch(t, []string{"b.txt", "c.txt", "dir", "dir/a.txt", "link"}, summary.Created)
+	assert.Empty(t, summary.Updated)
+
+	bs, err := afero.ReadFile(gfs, "/sync/dir/a.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(bs))
+
+	info, err := gfs.Stat("/sync/dir")
+	require.Nil(t, err)
+	assert.Equal(t, os.ModeDir|0750, info.Mode())
+
+	target, err := gfs.ReadlinkIfPossible("/sync/link")
+	require.Nil(t, err)
+	assert.Equal(t, "dir/a.txt", target)
+
+	b, err := gfs.Stat("/sync/b.txt")
+	require.Nil(t, err)
+	c, err := gfs.Stat("/sync/c.txt")
+	require.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), b.Mode())
+	assert.Equal(t, b.(interface{ Ino() int }).Ino(), c.(interface{ Ino() int }).Ino())
+
+	// change one file and add an extraneous one
+	mtime := time.Now().Add(time.Hour)
+	require.Nil(t, os.WriteFile(filepath.Join(src, "dir", "a.txt"), []byte("new text"), 0644))
+	require.Nil(t, os.Chtimes(filepath.Join(src, "dir", "a.txt"), mtime, mtime))
+	require.Nil(t, afero.WriteFile(gfs, "/sync/extra.txt", []byte("extra"), 0644))
+
+	summary, err = aferoguestfs.Sync(afero.NewOsFs(), src, gfs, "/sync", &aferoguestfs.SyncOptions{Delete: true})
+	require.Nil(t, err)
+	assert.Empty(t, summary.Created)
+	assert.Equal(t, []string{"dir/a.txt"}, summary.Updated)
+	assert.Equal(t, []string{"extra.txt"}, summary.Deleted)
+	assert.Equal(t, 4, summary.Unchanged)
+
+	bs, err = afero.ReadFile(gfs, "/sync/dir/a.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "new text", string(bs))
+
+	_, err = gfs.Stat("/sync/extra.txt")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSyncChecksum(t *testing.T) {
+	clear(t, gfs)
+
+	src := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("some text"), 0644))
+
+	_, err := aferoguestfs.Sync(afero.NewOsFs(), src, gfs, "/sync", nil)
+	require.Nil(t, err)
+
+	// same size and mtime, different content
+	info, err := os.Stat(filepath.Join(src, "a.txt"))
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("same size"), 0644))
+	require.Nil(t, os.Chtimes(filepath.Join(src, "a.txt"), info.ModTime(), info.ModTime()))
+
+	summary, err := aferoguestfs.Sync(afero.NewOsFs(), src, gfs, "/sync", nil)
+	require.Nil(t, err)
+	assert.Equal(t, 1, summary.Unchanged)
+
+	summary, err = aferoguestfs.Sync(afero.NewOsFs(), src, gfs, "/sync", &aferoguestfs.SyncOptions{Checksum: true})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"a.txt"}, summary.Updated)
+
+	bs, err := afero.ReadFile(gfs, "/sync/a.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "same size", string(bs))
+}
+
+func TestSyncDeleteSiblingPrefix(t *testing.T) {
+	clear(t, gfs)
+
+	src := t.TempDir()
+
+	// "a b" sorts between "a" and "a/x"
+	require.Nil(t, gfs.MkdirAll("/sync/a", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "/sync/a/x", []byte("x"), 0644))
+	require.Nil(t, afero.WriteFile(gfs, "/sync/a b", []byte("a b"), 0644))
+
+	summary, err := aferoguestfs.Sync(afero.NewOsFs(), src, gfs, "/sync", &aferoguestfs.SyncOptions{Delete: true})
+	require.Nil(t, err)
+	assert.Equal(t, []string{"a", "a b"}, summary.Deleted)
+
+	_, err = gfs.Stat("/sync/a")
+	assert.True(t, os.IsNotExist(err))
+	_, err = gfs.Stat("/sync/a b")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,283 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Account databases of the guest.
+const (
+	passwdFile = "/etc/passwd"
+	groupFile  = "/etc/group"
+)
+
+// User is an entry of the guest's /etc/passwd.
+type User struct {
+	Name  string
+	Uid   int
+	Gid   int
+	Gecos string
+	Home  string
+	Shell string
+}
+
+// Group is an entry of the guest's /etc/group.
+type Group struct {
+	Name    string
+	Gid     int
+	Members []string
+}
+
+// LookupUser looks up a user by name in the guest's /etc/passwd. The error
+// matches os.ErrNotExist if there is no such user.
+func (fs *Fs) LookupUser(name string) (*User, error) {
+	users, err := fs.users()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user %s: %w", name, os.ErrNotExist)
+}
+
+// LookupGroup looks up a group by name in the guest's /etc/group. The error
+// matches os.ErrNotExist if there is no such group.
+func (fs *Fs) LookupGroup(name string) (*Group, error) {
+	groups, err := fs.groups()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range groups {
+		if g.Name == name {
+			return g, nil
+		}
+	}
+
+	return nil, fmt.Errorf("group %s: %w", name, os.ErrNotExist)
+}
+
+// ChownName changes the owner and group of name, without following symlinks,
+// to the user and group of those names in the guest. Numeric IDs are accepted
+// too. An empty user or group is left unchanged.
+func (fs *Fs) ChownName(name string, user string, group string) error {
+	uid, gid := -1, -1
+
+	if user != "" {
+		if id, err := strconv.Atoi(user); err == nil {
+			uid = id
+		} else {
+			u, err := fs.LookupUser(user)
+			if err != nil {
+				return err
+			}
+			uid = u.Uid
+		}
+	}
+
+	if group != "" {
+		if id, err := strconv.Atoi(group); err == nil {
+			gid = id
+		} else {
+			g, err := fs.LookupGroup(group)
+			if err != nil {
+				return err
+			}
+			gid = g.Gid
+		}
+	}
+
+	return fs.Lchown(name, uid, gid)
+}
+
+func (fs *Fs) lookupUserID(uid int) (*User, error) {
+	users, err := fs.users()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		if u.Uid == uid {
+			return u, nil
+		}
+	}
+
+	return nil, fmt.Errorf("user %d: %w", uid, os.ErrNotExist)
+}
+
+func (fs *Fs) lookupGroupID(gid int) (*Group, error) {
+	groups, err := fs.groups()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, g := range groups {
+		if g.Gid == gid {
+			return g, nil
+		}
+	}
+
+	return nil, fmt.Errorf("group %d: %w", gid, os.ErrNotExist)
+}
+
+// idCache holds the parsed account databases. They are reparsed after writes
+// through Fs, or when their inode, size or modification time change, so
+// writes by other means are picked up too.
+type idCache struct {
+	mu     sync.Mutex
+	passwd idFile
+	group  idFile
+	users  []*User
+	groups []*Group
+}
+
+// idFile identifies the version of an account database that was parsed.
+type idFile struct {
+	parsed bool
+	ino    int64
+	size   int64
+	mtime  int64
+	mtimeN int64
+}
+
+// invalidate forgets the parsed account databases if name is one of them.
+func (c *idCache) invalidate(name string) {
+	if name != passwdFile && name != groupFile {
+		return
+	}
+	c.reset()
+}
+
+// reset drops the cached users and groups.
+func (c *idCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.passwd = idFile{}
+	c.group = idFile{}
+	c.users = nil
+	c.groups = nil
+}
+
+func (fs *Fs) users() ([]*User, error) {
+	fs.ids.mu.Lock()
+	defer fs.ids.mu.Unlock()
+
+	records, changed, err := fs.readIDFile(passwdFile, &fs.ids.passwd)
+	if err != nil || !changed {
+		return fs.ids.users, err
+	}
+
+	users := make([]*User, 0, len(records))
+	for _, r := range records {
+		if len(r) < 7 {
+			continue
+		}
+		uid, err := strconv.Atoi(r[2])
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.Atoi(r[3])
+		if err != nil {
+			continue
+		}
+		users = append(users, &User{
+			Name:  r[0],
+			Uid:   uid,
+			Gid:   gid,
+			Gecos: r[4],
+			Home:  r[5],
+			Shell: r[6],
+		})
+	}
+
+	fs.ids.users = users
+	return users, nil
+}
+
+func (fs *Fs) groups() ([]*Group, error) {
+	fs.ids.mu.Lock()
+	defer fs.ids.mu.Unlock()
+
+	records, changed, err := fs.readIDFile(groupFile, &fs.ids.group)
+	if err != nil || !changed {
+		return fs.ids.groups, err
+	}
+
+	groups := make([]*Group, 0, len(records))
+	for _, r := range records {
+		if len(r) < 4 {
+			continue
+		}
+		gid, err := strconv.Atoi(r[2])
+		if err != nil {
+			continue
+		}
+		var members []string
+		if r[3] != "" {
+			members = strings.Split(r[3], ",")
+		}
+		groups = append(groups, &Group{
+			Name:    r[0],
+			Gid:     gid,
+			Members: members,
+		})
+	}
+
+	fs.ids.groups = groups
+	return groups, nil
+}
+
+// readIDFile returns the colon separated records of name if it changed since
+// it was last read as f. A missing file has no records.
+func (fs *Fs) readIDFile(name string, f *idFile) ([][]string, bool, error) {
+	exists, err := fs.guestfs.Exists(name)
+	if err != nil {
+		return nil, false, wrapErr(err, name)
+	}
+	if !exists {
+		changed := f.parsed
+		*f = idFile{}
+		return nil, changed, nil
+	}
+
+	s, err := fs.guestfs.Statns(name)
+	if err != nil {
+		return nil, false, wrapErr(err, name)
+	}
+
+	cur := idFile{
+		parsed: true,
+		ino:    s.St_ino,
+		size:   s.St_size,
+		mtime:  s.St_mtime_sec,
+		mtimeN: s.St_mtime_nsec,
+	}
+	if cur == *f {
+		return nil, false, nil
+	}
+
+	content, err := fs.guestfs.Read_file(name)
+	if err != nil {
+		return nil, false, wrapErr(err, name)
+	}
+
+	var records [][]string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		records = append(records, strings.Split(line, ":"))
+	}
+
+	*f = cur
+	return records, true, nil
+}
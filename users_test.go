@@ -0,0 +1,72 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChownName(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.Mkdir("/etc", 0755))
+	require.Nil(t, afero.WriteFile(gfs, "/etc/passwd", []byte(
+		"root:x:0:0:root:/root:/bin/sh\n"+
+			"nginx:x:101:102:nginx user:/var/lib/nginx:/sbin/nologin\n"), 0644))
+	require.Nil(t, afero.WriteFile(gfs, "/etc/group", []byte(
+		"# comment\n"+
+			"root:x:0:\n"+
+			"nginx:x:102:nginx,www\n"), 0644))
+
+	u, err := gfs.LookupUser("nginx")
+	require.Nil(t, err)
+	assert.Equal(t, &aferoguestfs.User{
+		Name:  "nginx",
+		Uid:   101,
+		Gid:   102,
+		Gecos: "nginx user",
+		Home:  "/var/lib/nginx",
+		Shell: "/sbin/nologin",
+	}, u)
+
+	g, err := gfs.LookupGroup("nginx")
+	require.Nil(t, err)
+	assert.Equal(t, &aferoguestfs.Group{Name: "nginx", Gid: 102, Members: []string{"nginx", "www"}}, g)
+
+	_, err = gfs.LookupUser("www")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.Nil(t, afero.WriteFile(gfs, "/test.txt", []byte("some text"), 0644))
+	require.Nil(t, gfs.ChownName("/test.txt", "nginx", "nginx"))
+
+	info, err := gfs.Stat("/test.txt")
+	require.Nil(t, err)
+	owner := info.(interface {
+		Uid() int
+		Gid() int
+		Uname() string
+		Gname() string
+	})
+	assert.Equal(t, 101, owner.Uid())
+	assert.Equal(t, 102, owner.Gid())
+	assert.Equal(t, "nginx", owner.Uname())
+	assert.Equal(t, "nginx", owner.Gname())
+
+	// the cache is invalidated on writes
+	require.Nil(t, afero.WriteFile(gfs, "/etc/passwd", []byte(
+		"root:x:0:0:root:/root:/bin/sh\n"+
+			"www:x:101:102::/var/www:/sbin/nologin\n"), 0644))
+	assert.Equal(t, "www", owner.Uname())
+
+	require.Nil(t, gfs.ChownName("/test.txt", "", "0"))
+	info, err = gfs.Stat("/test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, 101, info.(interface{ Uid() int }).Uid())
+	assert.Equal(t, "root", info.(interface{ Gname() string }).Gname())
+
+	assert.NotNil(t, gfs.ChownName("/test.txt", "unknown", ""))
+}
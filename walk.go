@@ -0,0 +1,162 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/gaboose/afero-guestfs/libguestfs.org/guestfs"
+)
+
+// treeEntry is a file found by walkTree.
+type treeEntry struct {
+	info *fileInfo
+
+	// target is the target of a symlink
+	target string
+
+	// xattrs are only set if requested from walkTree
+	xattrs map[string][]byte
+}
+
+// walkTree calls fn for every file below dir with its path relative to dir,
+// parents before children. Files are stat'ed one directory at a time with the
+// batched lstatnslist, readlinklist and lxattrlist calls.
+func (fs *Fs) walkTree(dir string, withXattrs bool, fn func(rel string, e *treeEntry) error) error {
+	dir = fs.resolvePath(dir)
+
+	queue := []string{""}
+	for len(queue) > 0 {
+		rel := queue[0]
+		queue = queue[1:]
+
+		abs := filepath.Join(dir, rel)
+		entries, err := fs.readDirBatch(abs, withXattrs)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			childRel := filepath.Join(rel, e.info.name)
+			if err := fn(childRel, e); err != nil {
+				return err
+			}
+			if e.info.IsDir() {
+				queue = append(queue, childRel)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readDirBatch lstats all files in dir with a constant number of calls into
+// the appliance.
+func (fs *Fs) readDirBatch(dir string, withXattrs bool) ([]*treeEntry, error) {
+	names, err := fs.guestfs.Ls(dir)
+	if err != nil {
+		return nil, wrapErr(err, dir)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	stats, err := fs.guestfs.Lstatnslist(dir, names)
+	if err != nil {
+		return nil, wrapErr(err, dir)
+	}
+	if len(*stats) != len(names) {
+		return nil, fmt.Errorf("lstatnslist %s: got %d results for %d names", dir, len(*stats), len(names))
+	}
+
+	ret := make([]*treeEntry, 0, len(names))
+	hasSymlinks := false
+	for i, name := range names {
+		s := (*stats)[i]
+		if s.St_ino == -1 {
+			// removed since Ls
+			ret = append(ret, nil)
+			continue
+		}
+		e := &treeEntry{info: &fileInfo{fs: fs, name: name, stat: &s}}
+		hasSymlinks = hasSymlinks || s.St_mode&syscall.S_IFMT == syscall.S_IFLNK
+		ret = append(ret, e)
+	}
+
+	if hasSymlinks {
+		targets, err := fs.guestfs.Readlinklist(dir, names)
+		if err != nil {
+			return nil, wrapErr(err, dir)
+		}
+		for i, e := range ret {
+			if e != nil && i < len(targets) {
+				e.target = targets[i]
+			}
+		}
+	}
+
+	if withXattrs {
+		xattrs, err := fs.guestfs.Lxattrlist(dir, names)
+		if err != nil {
+			return nil, wrapErr(err, dir)
+		}
+		lists, err := splitXattrList(*xattrs, len(names))
+		if err != nil {
+			return nil, fmt.Errorf("lxattrlist %s: %w", dir, err)
+		}
+		for i, e := range ret {
+			if e != nil {
+				e.xattrs = lists[i]
+			}
+		}
+	}
+
+	filtered := ret[:0]
+	for _, e := range ret {
+		if e != nil {
+			filtered = append(filtered, e)
+		}
+	}
+
+	return filtered, nil
+}
+
+// splitXattrList splits the result of lxattrlist into one map per name. Each
+// name's attributes are preceded by an entry with an empty name and the
+// number of attributes as its value.
+func splitXattrList(xattrs []guestfs.XAttr, n int) ([]map[string][]byte, error) {
+	ret := make([]map[string][]byte, 0, n)
+
+	for i := 0; i < len(xattrs); {
+		if xattrs[i].Attrname != "" {
+			return nil, fmt.Errorf("expected count at %d, got %s", i, xattrs[i].Attrname)
+		}
+
+		count, err := strconv.Atoi(string(xattrs[i].Attrval))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse count at %d: %w", i, err)
+		}
+		i++
+
+		// files that couldn't be read have a negative count
+		count = max(count, 0)
+
+		if i+count > len(xattrs) {
+			return nil, fmt.Errorf("count %d at %d exceeds list", count, i-1)
+		}
+
+		m := make(map[string][]byte, count)
+		for _, x := range xattrs[i : i+count] {
+			m[x.Attrname] = x.Attrval
+		}
+		ret = append(ret, m)
+		i += count
+	}
+
+	if len(ret) != n {
+		return nil, fmt.Errorf("got %d results for %d names", len(ret), n)
+	}
+
+	return ret, nil
+}
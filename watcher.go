@@ -0,0 +1,228 @@
+package aferoguestfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inotify event masks, see inotify(7).
+const (
+	inModify     = 0x00000002
+	inAttrib     = 0x00000004
+	inMovedFrom  = 0x00000040
+	inMovedTo    = 0x00000080
+	inCreate     = 0x00000100
+	inDelete     = 0x00000200
+	inDeleteSelf = 0x00000400
+	inMoveSelf   = 0x00000800
+
+	inAllEvents = inModify | inAttrib | inMovedFrom | inMovedTo | inCreate |
+		inDelete | inDeleteSelf | inMoveSelf
+)
+
+// watchPollInterval is how often the appliance is polled for events.
+const watchPollInterval = 100 * time.Millisecond
+
+// Op describes a set of file operations.
+type Op uint32
+
+// File operations reported by Watcher.
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+// String returns the names of the operations in op, e.g. "CREATE|WRITE".
+func (op Op) String() string {
+	var names []string
+	for _, o := range []struct {
+		op   Op
+		name string
+	}{
+		{Create, "CREATE"},
+		{Write, "WRITE"},
+		{Remove, "REMOVE"},
+		{Rename, "RENAME"},
+		{Chmod, "CHMOD"},
+	} {
+		if op&o.op != 0 {
+			names = append(names, o.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is a file operation reported by Watcher.
+type Event struct {
+	// Name is the path of the file the operation happened to.
+	Name string
+	Op   Op
+}
+
+// Watcher watches files and directories of the guest for changes using
+// inotify in the appliance. Watching a directory reports changes to the files
+// in it, but not recursively.
+//
+// Only one Watcher can be open per guestfs handle at a time.
+type Watcher struct {
+	// Events delivers the file operations.
+	Events chan Event
+	// Errors delivers errors polling for events.
+	Errors chan error
+
+	fs *Fs
+
+	mu      sync.Mutex
+	watches map[int64]string
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewWatcher creates a new Watcher and starts polling for events.
+func (fs *Fs) NewWatcher() (*Watcher, error) {
+	if err := fs.guestfs.Inotify_init(0); err != nil {
+		return nil, fmt.Errorf("inotify init failed: %w", err)
+	}
+
+	w := &Watcher{
+		Events:  make(chan Event),
+		Errors:  make(chan error),
+		fs:      fs,
+		watches: map[int64]string{},
+		done:    make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+	go w.poll()
+
+	return w, nil
+}
+
+// Add starts watching name.
+func (w *Watcher) Add(name string) error {
+	name = w.fs.resolvePath(name)
+
+	wd, err := w.fs.guestfs.Inotify_add_watch(name, inAllEvents)
+	if err != nil {
+		return wrapErr(err, name)
+	}
+
+	w.mu.Lock()
+	w.watches[wd] = name
+	w.mu.Unlock()
+
+	return nil
+}
+
+// Remove stops watching name.
+func (w *Watcher) Remove(name string) error {
+	name = w.fs.resolvePath(name)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for wd, n := range w.watches {
+		if n != name {
+			continue
+		}
+		if err := w.fs.guestfs.Inotify_rm_watch(int(wd)); err != nil {
+			return wrapErr(err, name)
+		}
+		delete(w.watches, wd)
+		return nil
+	}
+
+	return fmt.Errorf("can't remove non-existent watch for %s", name)
+}
+
+// Close stops watching and closes the Events and Errors channels. Calling it
+// again returns the result of the first call.
+func (w *Watcher) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.wg.Wait()
+
+		close(w.Events)
+		close(w.Errors)
+
+		if err := w.fs.guestfs.Inotify_close(); err != nil {
+			w.closeErr = fmt.Errorf("inotify close failed: %w", err)
+		}
+	})
+	return w.closeErr
+}
+
+func (w *Watcher) poll() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		evs, err := w.fs.guestfs.Inotify_read()
+		if err != nil {
+			select {
+			case w.Errors <- fmt.Errorf("inotify read failed: %w", err):
+			case <-w.done:
+				return
+			}
+			continue
+		}
+
+		for _, ev := range *evs {
+			op := eventOp(ev.In_mask)
+			if op == 0 {
+				continue
+			}
+
+			w.mu.Lock()
+			name, ok := w.watches[ev.In_wd]
+			w.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			select {
+			case w.Events <- Event{Name: filepath.Join(name, ev.In_name), Op: op}:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// eventOp converts an inotify event mask to file operations.
+func eventOp(mask uint32) Op {
+	var op Op
+	if mask&(inCreate|inMovedTo) != 0 {
+		op |= Create
+	}
+	if mask&inModify != 0 {
+		op |= Write
+	}
+	if mask&(inDelete|inDeleteSelf) != 0 {
+		op |= Remove
+	}
+	if mask&(inMovedFrom|inMoveSelf) != 0 {
+		op |= Rename
+	}
+	if mask&inAttrib != 0 {
+		op |= Chmod
+	}
+	return op
+}
@@ -0,0 +1,59 @@
+package aferoguestfs_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	clear(t, gfs)
+
+	require.Nil(t, gfs.Mkdir("watched", os.ModePerm))
+
+	w, err := gfs.NewWatcher()
+	require.Nil(t, err)
+	defer w.Close()
+
+	require.Nil(t, w.Add("watched"))
+
+	require.Nil(t, afero.WriteFile(gfs, "watched/test.txt", []byte("some text"), os.ModePerm))
+	require.Nil(t, gfs.Remove("watched/test.txt"))
+
+	var ops []aferoguestfs.Op
+	timeout := time.After(5 * time.Second)
+	for len(ops) == 0 || ops[len(ops)-1] != aferoguestfs.Remove {
+		select {
+		case ev := <-w.Events:
+			assert.Equal(t, "/watched/test.txt", ev.Name)
+			ops = append(ops, ev.Op)
+		case err := <-w.Errors:
+			require.Nil(t, err)
+		case <-timeout:
+			require.FailNow(t, "timed out waiting for events", "got %v", ops)
+		}
+	}
+
+	assert.Equal(t, aferoguestfs.Create, ops[0])
+	assert.Contains(t, ops, aferoguestfs.Write)
+}
+
+func TestWatcherCloseTwice(t *testing.T) {
+	w, err := gfs.NewWatcher()
+	require.Nil(t, err)
+
+	assert.Nil(t, w.Close())
+	assert.NotPanics(t, func() {
+		assert.Nil(t, w.Close())
+	})
+}
+
+func TestOpString(t *testing.T) {
+	assert.Equal(t, "CREATE|WRITE", (aferoguestfs.Create | aferoguestfs.Write).String())
+	assert.Equal(t, "CHMOD", aferoguestfs.Chmod.String())
+}
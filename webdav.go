@@ -0,0 +1,132 @@
+package aferoguestfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/net/webdav"
+)
+
+// WebDAVFileSystem implements webdav.FileSystem over an Fs.
+type WebDAVFileSystem struct {
+	fs *Fs
+}
+
+// NewWebDAVFileSystem returns a WebDAVFileSystem for fs. Use it as the
+// FileSystem of a webdav.Handler.
+func NewWebDAVFileSystem(fs *Fs) *WebDAVFileSystem {
+	return &WebDAVFileSystem{fs: fs}
+}
+
+// Mkdir implements webdav.FileSystem.
+func (w *WebDAVFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return w.fs.Mkdir(name, perm)
+}
+
+// OpenFile implements webdav.FileSystem.
+func (w *WebDAVFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = w.fs.resolvePath(name)
+
+	if flag&os.O_CREATE != 0 {
+		// fail now rather than when the file is written on Close
+		dir := filepath.Dir(name)
+		info, err := w.fs.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOTDIR}
+		}
+	}
+
+	f, err := newFile(w.fs, name, flag, perm)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: unwrapPathErr(err)}
+	}
+
+	return &webdavFile{file: f}, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (w *WebDAVFileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = w.fs.resolvePath(name)
+	if name == "/" {
+		return &os.PathError{Op: "removeall", Path: name, Err: os.ErrInvalid}
+	}
+
+	if err := w.fs.exists(name); err != nil {
+		return err
+	}
+
+	return w.fs.RemoveAll(name)
+}
+
+// Rename implements webdav.FileSystem.
+func (w *WebDAVFileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	oldName = w.fs.resolvePath(oldName)
+	newName = w.fs.resolvePath(newName)
+	if oldName == "/" || newName == "/" {
+		return &os.PathError{Op: "rename", Path: oldName, Err: os.ErrInvalid}
+	}
+
+	return w.fs.Rename(oldName, newName)
+}
+
+// Stat implements webdav.FileSystem.
+func (w *WebDAVFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return w.fs.Stat(name)
+}
+
+// webdavFile is a file opened through WebDAVFileSystem.
+type webdavFile struct {
+	*file
+}
+
+// Readdir implements webdav.File. Entries are lstat'ed in one batch, like
+// os.File.Readdir does. The webdav package reads all entries at once, so count
+// is ignored.
+func (f *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.stat == nil || !f.stat.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: f.name, Err: syscall.ENOTDIR}
+	}
+
+	entries, err := f.fs.readDirBatch(f.name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		ret = append(ret, e.info)
+	}
+	return ret, nil
+}
+
+// Stat implements webdav.File. Buffered writes are flushed first, so the
+// result reflects what has been written, as it does for an os.File.
+func (f *webdavFile) Stat() (os.FileInfo, error) {
+	if f.modified || f.stat == nil {
+		if err := f.flush(); err != nil {
+			return nil, err
+		}
+
+		info, err := f.fs.Stat(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.stat = info
+	}
+
+	return f.stat, nil
+}
+
+// unwrapPathErr returns the underlying error of an *os.PathError, so it can be
+// wrapped again without nesting.
+func unwrapPathErr(err error) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err
+	}
+	return err
+}
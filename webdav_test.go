@@ -0,0 +1,58 @@
+package aferoguestfs_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	aferoguestfs "github.com/gaboose/afero-guestfs"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+func TestWebDAVFileSystem(t *testing.T) {
+	clear(t, gfs)
+
+	srv := httptest.NewServer(&webdav.Handler{
+		FileSystem: aferoguestfs.NewWebDAVFileSystem(gfs),
+		LockSystem: webdav.NewMemLS(),
+	})
+	defer srv.Close()
+
+	do := func(method string, path string, body string, header http.Header) int {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.Nil(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusCreated, do("MKCOL", "/dir", "", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, do("MKCOL", "/dir", "", nil))
+	assert.Equal(t, http.StatusConflict, do("MKCOL", "/missing/dir", "", nil))
+
+	assert.Equal(t, http.StatusCreated, do(http.MethodPut, "/dir/test.txt", "some text", nil))
+	assert.Equal(t, http.StatusConflict, do(http.MethodPut, "/missing/test.txt", "some text", nil))
+
+	bs, err := afero.ReadFile(gfs, "/dir/test.txt")
+	require.Nil(t, err)
+	assert.Equal(t, "some text", string(bs))
+
+	assert.Equal(t, http.StatusMultiStatus, do("PROPFIND", "/dir", "", http.Header{"Depth": {"1"}}))
+
+	assert.Equal(t, http.StatusCreated, do("MOVE", "/dir/test.txt", "", http.Header{"Destination": {srv.URL + "/moved.txt"}}))
+	_, err = gfs.Stat("/moved.txt")
+	assert.Nil(t, err)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/dir", "", nil))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/dir", "", nil))
+}